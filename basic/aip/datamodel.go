@@ -28,6 +28,17 @@ const (
 	ColumnTypeString ColumnType = iota
 	// ColumnTypeBool is a column of type boolean.  NULL values are mapped to FALSE.
 	ColumnTypeBool = iota
+	// ColumnTypeInt64 is a column of type 64-bit integer.
+	ColumnTypeInt64 = iota
+	// ColumnTypeFloat64 is a column of type double precision floating point.
+	ColumnTypeFloat64 = iota
+	// ColumnTypeTimestamp is a column of type timestamp.
+	// Filter arguments are RFC 3339 timestamps.
+	ColumnTypeTimestamp = iota
+	// ColumnTypeDuration is a column storing a duration.
+	// Filter arguments are seconds with an 's' suffix, e.g. 20s or 1.2s,
+	// and are bound as time.Duration.
+	ColumnTypeDuration = iota
 )
 
 // ColumnType is an enum for the type of a column.  Valid values are in the const block above.
@@ -39,11 +50,32 @@ func (t ColumnType) String() string {
 		return "STRING"
 	case ColumnTypeBool:
 		return "BOOL"
+	case ColumnTypeInt64:
+		return "INT64"
+	case ColumnTypeFloat64:
+		return "FLOAT64"
+	case ColumnTypeTimestamp:
+		return "TIMESTAMP"
+	case ColumnTypeDuration:
+		return "DURATION"
 	default:
 		return "UNKNOWN"
 	}
 }
 
+// wildcardMode controls how * is interpreted in the arguments of the =
+// and != operators on a column.
+type wildcardMode int
+
+const (
+	// noWildcards matches * literally.
+	noWildcards wildcardMode = iota
+	// anyWildcards treats * anywhere in the argument as a wildcard.
+	anyWildcards
+	// prefixWildcards only allows a trailing * wildcard.
+	prefixWildcards
+)
+
 // Column represents the schema of a Database column.
 type Column struct {
 	// The externally-visible field path this column maps to.
@@ -63,6 +95,13 @@ type Column struct {
 	// Whether this column can be filtered on.
 	filterable bool
 
+	// Whether this column can be updated.
+	updatable bool
+
+	// Whether this column is output only (AIP-203), i.e. ignored in
+	// update masks.
+	outputOnly bool
+
 	// ImplicitFilter controls whether this field is searched implicitly
 	// in AIP-160 filter expressions.
 	implicitFilter bool
@@ -70,11 +109,27 @@ type Column struct {
 	// Whether this column is an array of structs with two string members: key and value.
 	keyValue bool
 
-	// The type of the column, defaults to ColumnType_STRING.
+	// Whether this column is an array of values of the column type.
+	repeated bool
+
+	// Whether this column is a JSON document whose values are referenced
+	// by the fields following the field path of the column.
+	json bool
+
+	// The path within the JSON document of the value the field path of the
+	// column refers to, empty for the whole document.
+	jsonPath []string
+
+	// The type of the column, defaults to ColumnType_STRING. For repeated
+	// columns, the type of the elements, and for JSON columns, the type of
+	// the referenced values.
 	columnType ColumnType
 
 	// The function which is applied to the filter arguments.
 	argSubstitute func(sub string) string
+
+	// How * is interpreted in the arguments of the = and != operators.
+	wildcards wildcardMode
 }
 
 // Table represents the schema of a Database table, view or query.
@@ -85,6 +140,57 @@ type Table struct {
 	// A mapping from externally-visible field path to the column
 	// definition. The column name used as a key is in lowercase.
 	columnByFieldPath map[string]*Column
+
+	// The SQL dialect of generated clauses, nil for the default dialect.
+	dialect Dialect
+
+	// The number of query parameters preceding the parameters of
+	// generated clauses in the query.
+	parameterOffset int
+
+	// The functions which may be called in AIP-160 filters, by
+	// qualified name.
+	functions map[string]SQLFunction
+
+	// The column with unique values appended to orders to make them total,
+	// nil if none.
+	tieBreaker *Column
+}
+
+// WithDialect returns a copy of the table which generates clauses in the
+// given dialect.
+func (t *Table) WithDialect(dialect Dialect) *Table {
+	result := &Table{}
+	*result = *t
+	result.dialect = dialect
+	return result
+}
+
+// WithParameterOffset returns a copy of the table which generates clauses
+// whose query parameters follow the given number of parameters in the
+// query. Dialects numbering their placeholders, such as PostgreSQL, number
+// the parameters of the clauses from offset+1, so that clauses can be
+// combined in a single query. For example:
+//
+//	where, wherePars, err := table.WhereClause(filter, "p_")
+//	...
+//	keyset, keysetPars, err := table.WithParameterOffset(len(wherePars)).KeysetClause(order, cursor, "k_")
+//	...
+//	query := "SELECT ... WHERE " + where + " AND " + keyset
+//	args := aip.PositionalArgs(append(wherePars, keysetPars...))
+func (t *Table) WithParameterOffset(offset int) *Table {
+	result := &Table{}
+	*result = *t
+	result.parameterOffset = offset
+	return result
+}
+
+// Dialect returns the SQL dialect used to generate clauses for the table.
+func (t *Table) Dialect() Dialect {
+	if t.dialect == nil {
+		return defaultDialect
+	}
+	return t.dialect
 }
 
 // FilterableColumnByFieldPath returns the database name of the filterable column
@@ -105,6 +211,27 @@ func (t *Table) FilterableColumnByFieldPath(path FieldPath) (*Column, error) {
 	return nil, err
 }
 
+// filterableColumnByMember returns the filterable column referenced by
+// the member of a restriction, together with the member fields
+// following the field path of the column.
+//
+// The column with the longest field path matching a prefix of the member
+// is used, so "a.b" refers to the column "a.b" if it exists, and to the
+// key "b" of the key value column "a" or the field "b" of the JSON column
+// "a" otherwise.
+func (t *Table) filterableColumnByMember(member *Member) (*Column, []string, error) {
+	segments := append([]string{member.Value}, member.Fields...)
+	for i := len(segments); i > 1; i-- {
+		path := NewFieldPath(segments[:i]...)
+		if _, ok := t.columnByFieldPath[path.String()]; ok {
+			column, err := t.FilterableColumnByFieldPath(path)
+			return column, segments[i:], err
+		}
+	}
+	column, err := t.FilterableColumnByFieldPath(NewFieldPath(member.Value))
+	return column, member.Fields, err
+}
+
 // SortableColumnByFieldPath returns the sortable database column
 // with the given externally-visible field path.
 func (t *Table) SortableColumnByFieldPath(path FieldPath) (*Column, error) {
@@ -14,6 +14,8 @@
 
 package aip
 
+import "fmt"
+
 type ColumnBuilder struct {
 	column Column
 }
@@ -54,12 +56,70 @@ func (c *ColumnBuilder) KeyValue() *ColumnBuilder {
 	return c
 }
 
+// Repeated specifies this column is an array of values of the column type,
+// e.g. NewColumn().Int64().Repeated() for an ARRAY<INT64> column.
+// Filters can only test whether the array contains an element with the
+// has operator, e.g. scores:42, and the column cannot be sorted on.
+func (c *ColumnBuilder) Repeated() *ColumnBuilder {
+	c.column.repeated = true
+	return c
+}
+
+// JSON specifies this column holds a JSON document, e.g. a JSON or jsonb
+// column, whose values are referenced by the fields following the field
+// path of the column, e.g. `spec.replicas > 2` for the column "spec".
+// The column type is the type of the referenced values; their path in
+// the document is bound as query parameters.
+//
+// path is the path in the document of the value the field path of the
+// column refers to, empty for the whole document. It allows declaring the
+// type of some values with another column on the same document:
+//
+//	NewColumn().WithFieldPath("spec").WithDatabaseName("spec").JSON().Filterable().Build(),
+//	NewColumn().WithFieldPath("spec", "replicas").WithDatabaseName("spec").JSON("replicas").Int64().Filterable().Build(),
+//
+// JSON columns cannot be sorted on, updated or filtered implicitly.
+func (c *ColumnBuilder) JSON(path ...string) *ColumnBuilder {
+	c.column.json = true
+	c.column.jsonPath = path
+	return c
+}
+
 // Bool specifies this column has bool type in the database.
 func (c *ColumnBuilder) Bool() *ColumnBuilder {
 	c.column.columnType = ColumnTypeBool
 	return c
 }
 
+// Int64 specifies this column has 64-bit integer type in the database.
+// Filter arguments are parsed as integers and bound as int64.
+func (c *ColumnBuilder) Int64() *ColumnBuilder {
+	c.column.columnType = ColumnTypeInt64
+	return c
+}
+
+// Float64 specifies this column has double precision floating point type
+// in the database. Filter arguments are parsed as numbers and bound as float64.
+func (c *ColumnBuilder) Float64() *ColumnBuilder {
+	c.column.columnType = ColumnTypeFloat64
+	return c
+}
+
+// Timestamp specifies this column has timestamp type in the database.
+// Filter arguments are parsed as RFC 3339 timestamps and bound as time.Time.
+func (c *ColumnBuilder) Timestamp() *ColumnBuilder {
+	c.column.columnType = ColumnTypeTimestamp
+	return c
+}
+
+// Duration specifies this column stores a duration in the database.
+// Filter arguments are parsed as seconds with an 's' suffix (e.g. 20s)
+// and bound as time.Duration.
+func (c *ColumnBuilder) Duration() *ColumnBuilder {
+	c.column.columnType = ColumnTypeDuration
+	return c
+}
+
 // Sortable specifies this column can be sorted on.
 func (c *ColumnBuilder) Sortable() *ColumnBuilder {
 	c.column.sortable = true
@@ -81,6 +141,22 @@ func (c *ColumnBuilder) FilterableImplicitly() *ColumnBuilder {
 	return c
 }
 
+// Updatable specifies this column can be updated by UpdateClause.
+func (c *ColumnBuilder) Updatable() *ColumnBuilder {
+	c.column.updatable = true
+	c.column.outputOnly = false
+	return c
+}
+
+// OutputOnly specifies this column is output only, as defined in AIP-203.
+// The column cannot be updated, and UpdateClause silently ignores it when
+// it is selected by an update mask.
+func (c *ColumnBuilder) OutputOnly() *ColumnBuilder {
+	c.column.outputOnly = true
+	c.column.updatable = false
+	return c
+}
+
 // WithArgumentSubstitutor specifies a substitution that should happen to the user-specified
 // filter argument before it is matched against the database value. If this option is enabled,
 // the filter operators permitted will be limited to = (equals) and != (not equals).
@@ -89,6 +165,27 @@ func (c *ColumnBuilder) WithArgumentSubstitutor(f func(sub string) string) *Colu
 	return c
 }
 
+// WithWildcards specifies the = and != operators treat * in their
+// argument as a wildcard matching any sequence of characters, e.g.
+// `hostname = "*.example.com"`. Such restrictions are generated as LIKE
+// expressions, with the rest of the argument escaped with QuoteLike.
+// Only string columns support wildcards.
+//
+// Leading wildcards prevent the database from using an index on the
+// column, see WithPrefixWildcards.
+func (c *ColumnBuilder) WithWildcards() *ColumnBuilder {
+	c.column.wildcards = anyWildcards
+	return c
+}
+
+// WithPrefixWildcards is like WithWildcards, but only allows a trailing
+// wildcard, e.g. `name = "publishers/123/*"`. The generated LIKE pattern
+// is then a prefix match, which can use an index on the column.
+func (c *ColumnBuilder) WithPrefixWildcards() *ColumnBuilder {
+	c.column.wildcards = prefixWildcards
+	return c
+}
+
 // Build returns the built column.
 func (c *ColumnBuilder) Build() *Column {
 	result := &Column{}
@@ -97,7 +194,10 @@ func (c *ColumnBuilder) Build() *Column {
 }
 
 type TableBuilder struct {
-	columns []*Column
+	columns    []*Column
+	dialect    Dialect
+	functions  map[string]SQLFunction
+	tieBreaker *FieldPath
 }
 
 // NewTable starts building a new table.
@@ -111,18 +211,101 @@ func (t *TableBuilder) WithColumns(columns ...*Column) *TableBuilder {
 	return t
 }
 
-// Build returns the built table.
+// WithDialect specifies the SQL dialect of the clauses generated for the
+// table. If not specified, GoogleSQL with unquoted column names is generated.
+func (t *TableBuilder) WithDialect(dialect Dialect) *TableBuilder {
+	t.dialect = dialect
+	return t
+}
+
+// WithFunction allows calls to the function with the given (qualified)
+// name in AIP-160 filters, translating them to SQL with f.
+// Functions which are not registered are rejected.
+func (t *TableBuilder) WithFunction(name string, f SQLFunction) *TableBuilder {
+	if t.functions == nil {
+		t.functions = make(map[string]SQLFunction)
+	}
+	t.functions[name] = f
+	return t
+}
+
+// WithTieBreaker specifies the column with the given field path holds
+// unique values, e.g. the primary key. It is appended in ascending order
+// to the orders of OrderByClause and KeysetClause, so that rows with
+// equal values in the ordered columns are returned in a stable order and
+// are not skipped or repeated across pages.
+func (t *TableBuilder) WithTieBreaker(segments ...string) *TableBuilder {
+	path := NewFieldPath(segments...)
+	t.tieBreaker = &path
+	return t
+}
+
+// Build returns the built table. It panics if the table is invalid,
+// use TryBuild to handle invalid tables gracefully.
 func (t *TableBuilder) Build() *Table {
+	table, err := t.TryBuild()
+	if err != nil {
+		panic(err.Error())
+	}
+	return table
+}
+
+// TryBuild returns the built table, or an error if the table is invalid.
+func (t *TableBuilder) TryBuild() (*Table, error) {
 	columnByFieldPath := make(map[string]*Column)
 	for _, c := range t.columns {
+		if c.repeated {
+			switch {
+			case c.keyValue:
+				return nil, fmt.Errorf("column cannot be both repeated and key value: %s", c.fieldPath.String())
+			case c.sortable:
+				return nil, fmt.Errorf("repeated column cannot be sortable: %s", c.fieldPath.String())
+			case c.implicitFilter:
+				return nil, fmt.Errorf("repeated column cannot be filtered implicitly: %s", c.fieldPath.String())
+			}
+		}
+		if c.json {
+			switch {
+			case c.keyValue || c.repeated:
+				return nil, fmt.Errorf("JSON column cannot be key value or repeated: %s", c.fieldPath.String())
+			case c.sortable:
+				return nil, fmt.Errorf("JSON column cannot be sortable: %s", c.fieldPath.String())
+			case c.implicitFilter:
+				return nil, fmt.Errorf("JSON column cannot be filtered implicitly: %s", c.fieldPath.String())
+			case c.columnType == ColumnTypeDuration:
+				return nil, fmt.Errorf("JSON column cannot have the DURATION type: %s", c.fieldPath.String())
+			}
+		}
+		if c.wildcards != noWildcards && (c.columnType != ColumnTypeString || c.keyValue || c.repeated) {
+			return nil, fmt.Errorf("wildcards are only supported on string columns: %s", c.fieldPath.String())
+		}
 		if _, ok := columnByFieldPath[c.fieldPath.String()]; ok {
-			panic("multiple columns with the same field path: " + c.fieldPath.String())
+			return nil, fmt.Errorf("multiple columns with the same field path: %s", c.fieldPath.String())
 		}
 		columnByFieldPath[c.fieldPath.String()] = c
 	}
+	var tieBreaker *Column
+	if t.tieBreaker != nil {
+		tieBreaker = columnByFieldPath[t.tieBreaker.String()]
+		if tieBreaker == nil {
+			return nil, fmt.Errorf("no column for the tie-breaker field path: %s", t.tieBreaker.String())
+		}
+		if tieBreaker.keyValue {
+			return nil, fmt.Errorf("tie-breaker cannot be a key value column: %s", t.tieBreaker.String())
+		}
+		if tieBreaker.repeated {
+			return nil, fmt.Errorf("tie-breaker cannot be a repeated column: %s", t.tieBreaker.String())
+		}
+		if tieBreaker.json {
+			return nil, fmt.Errorf("tie-breaker cannot be a JSON column: %s", t.tieBreaker.String())
+		}
+	}
 
 	return &Table{
 		columns:           t.columns,
 		columnByFieldPath: columnByFieldPath,
-	}
+		dialect:           t.dialect,
+		functions:         t.functions,
+		tieBreaker:        tieBreaker,
+	}, nil
 }
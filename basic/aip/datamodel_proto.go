@@ -0,0 +1,158 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MessageFieldMapper customizes the column of a message field in
+// TableFromMessage. It receives the field path of the column, the
+// descriptor of the field, and a builder with the field path, database
+// name and column type populated but no capabilities. It returns the
+// builder of the column, or nil to omit the field from the table.
+//
+// Example, exposing only some fields and renaming a column:
+//
+//	func(path aip.FieldPath, fd protoreflect.FieldDescriptor, c *aip.ColumnBuilder) *aip.ColumnBuilder {
+//		switch path.String() {
+//		case "display_name":
+//			return c.WithDatabaseName("title").FilterableImplicitly().Sortable()
+//		case "create_time":
+//			return c.Filterable().Sortable()
+//		}
+//		return nil
+//	}
+type MessageFieldMapper func(path FieldPath, field protoreflect.FieldDescriptor, column *ColumnBuilder) *ColumnBuilder
+
+// TableFromMessage builds a table with a column for each field of the
+// message, using the proto field names as field path segments.
+//
+// Fields of nested messages are flattened into columns with multi-segment
+// field paths, e.g. "author.display_name". map<string, string> fields
+// become key value columns. google.protobuf.Timestamp, Duration and the
+// wrapper types map to the corresponding scalar column types, and enums
+// are string columns holding the value names. Repeated fields of these
+// types become repeated columns. Other repeated fields, bytes and other map
+// fields are omitted.
+//
+// The database name of a column defaults to its field path segments
+// joined with '_'. Without a mapper, every column is filterable and every
+// column other than key value and repeated columns is sortable.
+func TableFromMessage(md protoreflect.MessageDescriptor, mapper MessageFieldMapper) (*Table, error) {
+	if mapper == nil {
+		mapper = defaultMessageFieldMapper
+	}
+	b := &messageTableBuilder{mapper: mapper, visiting: make(map[protoreflect.FullName]bool)}
+	if err := b.message(md, nil); err != nil {
+		return nil, errors.WithMessagef(err, "message %s", md.FullName())
+	}
+	return NewTable().WithColumns(b.columns...).TryBuild()
+}
+
+func defaultMessageFieldMapper(_ FieldPath, _ protoreflect.FieldDescriptor, column *ColumnBuilder) *ColumnBuilder {
+	column.Filterable()
+	if !column.column.keyValue && !column.column.repeated {
+		column.Sortable()
+	}
+	return column
+}
+
+type messageTableBuilder struct {
+	mapper  MessageFieldMapper
+	columns []*Column
+	// The messages being traversed, to stop at recursive message fields.
+	visiting map[protoreflect.FullName]bool
+}
+
+func (b *messageTableBuilder) message(md protoreflect.MessageDescriptor, prefix []string) error {
+	b.visiting[md.FullName()] = true
+	defer delete(b.visiting, md.FullName())
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		segments := append(append([]string{}, prefix...), string(fd.Name()))
+		column := NewColumn().WithFieldPath(segments...).WithDatabaseName(strings.Join(segments, "_"))
+		switch {
+		case fd.IsMap():
+			if fd.MapKey().Kind() != protoreflect.StringKind || fd.MapValue().Kind() != protoreflect.StringKind {
+				continue
+			}
+			column.KeyValue()
+		case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+			columnType, ok := wellKnownColumnTypes[fd.Message().FullName()]
+			if !ok {
+				if fd.IsList() || b.visiting[fd.Message().FullName()] {
+					continue
+				}
+				if err := b.message(fd.Message(), segments); err != nil {
+					return err
+				}
+				continue
+			}
+			column.column.columnType = columnType
+		default:
+			columnType, ok := scalarColumnType(fd.Kind())
+			if !ok {
+				continue
+			}
+			column.column.columnType = columnType
+		}
+		if fd.IsList() {
+			column.Repeated()
+		}
+		if column = b.mapper(NewFieldPath(segments...), fd, column); column != nil {
+			b.columns = append(b.columns, column.Build())
+		}
+	}
+	return nil
+}
+
+// wellKnownColumnTypes maps well-known message types to the column type
+// of their value.
+var wellKnownColumnTypes = map[protoreflect.FullName]ColumnType{
+	"google.protobuf.Timestamp":   ColumnTypeTimestamp,
+	"google.protobuf.Duration":    ColumnTypeDuration,
+	"google.protobuf.StringValue": ColumnTypeString,
+	"google.protobuf.BoolValue":   ColumnTypeBool,
+	"google.protobuf.Int32Value":  ColumnTypeInt64,
+	"google.protobuf.Int64Value":  ColumnTypeInt64,
+	"google.protobuf.UInt32Value": ColumnTypeInt64,
+	"google.protobuf.UInt64Value": ColumnTypeInt64,
+	"google.protobuf.FloatValue":  ColumnTypeFloat64,
+	"google.protobuf.DoubleValue": ColumnTypeFloat64,
+}
+
+// scalarColumnType returns the column type of a scalar proto kind.
+func scalarColumnType(kind protoreflect.Kind) (ColumnType, bool) {
+	switch kind {
+	case protoreflect.StringKind, protoreflect.EnumKind:
+		return ColumnTypeString, true
+	case protoreflect.BoolKind:
+		return ColumnTypeBool, true
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return ColumnTypeInt64, true
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return ColumnTypeFloat64, true
+	}
+	return 0, false
+}
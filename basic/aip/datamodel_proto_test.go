@@ -0,0 +1,178 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// testBookDescriptor returns the descriptor of the following message:
+//
+//	message Book {
+//	  enum State { STATE_UNSPECIFIED = 0; DRAFT = 1; PUBLISHED = 2; }
+//	  message Author { string display_name = 1; Book favorite = 2; }
+//	  string name = 1;
+//	  string display_name = 2;
+//	  int32 pages = 3;
+//	  double rating = 4;
+//	  bool published = 5;
+//	  google.protobuf.Timestamp create_time = 6;
+//	  map<string, string> labels = 7;
+//	  repeated string tags = 8;
+//	  State state = 9;
+//	  Author author = 10;
+//	  bytes cover = 11;
+//	  google.protobuf.Int64Value edition = 12;
+//	}
+func testBookDescriptor() protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	repeated := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return f
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("aip/test_book.proto"),
+		Package:    proto.String("aip.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/wrappers.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Book"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("display_name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("pages", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				field("rating", 4, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				field("published", 5, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+				field("create_time", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				repeated(field("labels", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".aip.test.Book.LabelsEntry")),
+				repeated(field("tags", 8, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")),
+				field("state", 9, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".aip.test.Book.State"),
+				field("author", 10, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".aip.test.Book.Author"),
+				field("cover", 11, descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""),
+				field("edition", 12, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Int64Value"),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				{
+					Name: proto.String("LabelsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+						field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				},
+				{
+					Name: proto.String("Author"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("display_name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+						field("favorite", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".aip.test.Book"),
+					},
+				},
+			},
+			EnumType: []*descriptorpb.EnumDescriptorProto{{
+				Name: proto.String("State"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{
+					{Name: proto.String("STATE_UNSPECIFIED"), Number: proto.Int32(0)},
+					{Name: proto.String("DRAFT"), Number: proto.Int32(1)},
+					{Name: proto.String("PUBLISHED"), Number: proto.Int32(2)},
+				},
+			}},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	return fd.Messages().ByName("Book")
+}
+
+func TestTableFromMessage(t *testing.T) {
+	Convey("TableFromMessage", t, func() {
+		md := testBookDescriptor()
+
+		Convey("Default mapping", func() {
+			table, err := TableFromMessage(md, nil)
+			So(err, ShouldBeNil)
+			So(table.columns, ShouldResemble, []*Column{
+				NewColumn().WithFieldPath("name").WithDatabaseName("name").Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("display_name").WithDatabaseName("display_name").Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("pages").WithDatabaseName("pages").Int64().Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("rating").WithDatabaseName("rating").Float64().Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("published").WithDatabaseName("published").Bool().Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("create_time").WithDatabaseName("create_time").Timestamp().Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("labels").WithDatabaseName("labels").KeyValue().Filterable().Build(),
+				NewColumn().WithFieldPath("tags").WithDatabaseName("tags").Repeated().Filterable().Build(),
+				NewColumn().WithFieldPath("state").WithDatabaseName("state").Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("author", "display_name").WithDatabaseName("author_display_name").Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("edition").WithDatabaseName("edition").Int64().Filterable().Sortable().Build(),
+			})
+		})
+		Convey("Custom mapping", func() {
+			table, err := TableFromMessage(md, func(path FieldPath, fd protoreflect.FieldDescriptor, c *ColumnBuilder) *ColumnBuilder {
+				switch path.String() {
+				case "display_name":
+					return c.WithDatabaseName("title").FilterableImplicitly()
+				case "author.display_name":
+					return c.WithDatabaseName("author").Sortable()
+				case "state":
+					return c.Int64().Filterable()
+				}
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(table.columns, ShouldResemble, []*Column{
+				NewColumn().WithFieldPath("display_name").WithDatabaseName("title").FilterableImplicitly().Build(),
+				NewColumn().WithFieldPath("state").WithDatabaseName("state").Int64().Filterable().Build(),
+				NewColumn().WithFieldPath("author", "display_name").WithDatabaseName("author").Sortable().Build(),
+			})
+
+			filter, err := ParseFilter(`author.display_name = x`)
+			So(err, ShouldBeNil)
+			_, _, err = table.WhereClause(filter, "p_")
+			So(err, ShouldErrLike, "no filterable field \"author.display_name\"")
+		})
+		Convey("Nested fields are referenced by their field path", func() {
+			table, err := TableFromMessage(md, nil)
+			So(err, ShouldBeNil)
+			filter, err := ParseFilter(`author.display_name = x`)
+			So(err, ShouldBeNil)
+			result, pars, err := table.WhereClause(filter, "p_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "(author_display_name = @p_0)")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "p_0", Value: "x"}})
+		})
+	})
+}
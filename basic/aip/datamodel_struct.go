@@ -0,0 +1,280 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// TableFromStruct builds a table from the tags of a struct, typically a
+// GORM model. v must be a struct or a pointer to a struct.
+//
+// Only fields with an `aip` tag become columns. The tag is a comma
+// separated list of options:
+//   - path=a.b: the field path of the column, defaults to the snake case
+//     field name.
+//   - filter: the column can be filtered on.
+//   - implicit: the column can be filtered on implicitly.
+//   - sort: the column can be sorted on.
+//   - update: the column can be updated.
+//   - output_only: the column is output only, see ColumnBuilder.OutputOnly.
+//   - kv: the column is a key value column (inferred for map[string]string).
+//   - json: the column is a JSON column, see ColumnBuilder.JSON. The type
+//     option gives the type of its values, which defaults to string.
+//   - type=int64: overrides the inferred column type; one of string, bool,
+//     int64, float64, timestamp or duration.
+//
+// Slices other than []byte, e.g. []string, are repeated columns of their
+// element type, see ColumnBuilder.Repeated.
+//
+// The database name is taken from the `gorm:"column:..."` tag and
+// defaults to the snake case field name, as in GORM. Fields of embedded
+// structs are included. A tag of `aip:"-"` skips the field.
+//
+// Example:
+//
+//	type Book struct {
+//		ID          int64     `aip:"path=name,filter,sort"`
+//		DisplayName string    `aip:"filter,implicit,sort" gorm:"column:title"`
+//		CreateTime  time.Time `aip:"filter,sort"`
+//	}
+func TableFromStruct(v any) (*Table, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("expected a struct but got %T", v)
+	}
+	columns, err := structColumns(t)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "struct %s", t.String())
+	}
+	return NewTable().WithColumns(columns...).TryBuild()
+}
+
+// structColumns returns the columns declared by the tagged fields of the struct type.
+func structColumns(t reflect.Type) ([]*Column, error) {
+	var columns []*Column
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, tagged := field.Tag.Lookup("aip")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && !tagged {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded, err := structColumns(ft)
+				if err != nil {
+					return nil, err
+				}
+				columns = append(columns, embedded...)
+			}
+			continue
+		}
+		if !tagged {
+			continue
+		}
+		if !field.IsExported() {
+			return nil, errors.Errorf("field %s: aip tag on unexported field", field.Name)
+		}
+		column, err := structFieldColumn(field, tag)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "field %s", field.Name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// structFieldColumn builds the column for a struct field with the given aip tag.
+func structFieldColumn(field reflect.StructField, tag string) (*Column, error) {
+	builder := NewColumn().WithDatabaseName(gormColumnName(field))
+	path := toSnakeCase(field.Name)
+	typeName := ""
+	keyValue := false
+	for _, option := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch name {
+		case "":
+		case "path":
+			path = value
+		case "filter":
+			builder.Filterable()
+		case "implicit":
+			builder.FilterableImplicitly()
+		case "sort":
+			builder.Sortable()
+		case "update":
+			builder.Updatable()
+		case "output_only":
+			builder.OutputOnly()
+		case "kv":
+			keyValue = true
+		case "json":
+			builder.JSON()
+			if typeName == "" {
+				typeName = "string"
+			}
+		case "type":
+			typeName = value
+		default:
+			return nil, errors.Errorf("unknown aip tag option %q", name)
+		}
+	}
+	if path == "" {
+		return nil, errors.New("empty field path")
+	}
+	builder.WithFieldPath(strings.Split(path, ".")...)
+
+	if keyValue || (!builder.column.json && isStringMap(field.Type)) {
+		builder.KeyValue()
+		if typeName == "" {
+			typeName = "string"
+		}
+	}
+	fieldType := field.Type
+	if !keyValue && !builder.column.json && isRepeatedType(fieldType) {
+		builder.Repeated()
+		fieldType = fieldType.Elem()
+	}
+	columnType, err := structFieldType(fieldType, typeName)
+	if err != nil {
+		return nil, err
+	}
+	builder.column.columnType = columnType
+	return builder.Build(), nil
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	nullStringType = reflect.TypeOf(sql.NullString{})
+	nullBoolType   = reflect.TypeOf(sql.NullBool{})
+	nullTimeType   = reflect.TypeOf(sql.NullTime{})
+	nullFloatType  = reflect.TypeOf(sql.NullFloat64{})
+	nullIntTypes   = []reflect.Type{
+		reflect.TypeOf(sql.NullInt64{}),
+		reflect.TypeOf(sql.NullInt32{}),
+		reflect.TypeOf(sql.NullInt16{}),
+		reflect.TypeOf(sql.NullByte{}),
+	}
+	columnTypeByName = map[string]ColumnType{
+		"string":    ColumnTypeString,
+		"bool":      ColumnTypeBool,
+		"int64":     ColumnTypeInt64,
+		"float64":   ColumnTypeFloat64,
+		"timestamp": ColumnTypeTimestamp,
+		"duration":  ColumnTypeDuration,
+	}
+)
+
+// structFieldType returns the column type of the named type, or the type
+// inferred from the Go type of the field if no name is given.
+func structFieldType(t reflect.Type, name string) (ColumnType, error) {
+	if name != "" {
+		columnType, ok := columnTypeByName[name]
+		if !ok {
+			return 0, errors.Errorf("unknown column type %q", name)
+		}
+		return columnType, nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType, nullTimeType:
+		return ColumnTypeTimestamp, nil
+	case durationType:
+		return ColumnTypeDuration, nil
+	case nullStringType:
+		return ColumnTypeString, nil
+	case nullBoolType:
+		return ColumnTypeBool, nil
+	case nullFloatType:
+		return ColumnTypeFloat64, nil
+	}
+	for _, nullInt := range nullIntTypes {
+		if t == nullInt {
+			return ColumnTypeInt64, nil
+		}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return ColumnTypeString, nil
+	case reflect.Bool:
+		return ColumnTypeBool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ColumnTypeInt64, nil
+	case reflect.Float32, reflect.Float64:
+		return ColumnTypeFloat64, nil
+	}
+	return 0, errors.Errorf("unable to infer column type of %s, specify it with the type option", t.String())
+}
+
+// isRepeatedType returns whether t is a slice or array other than bytes.
+func isRepeatedType(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+func isStringMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String
+}
+
+// gormColumnName returns the database name of the column of the field,
+// following GORM conventions.
+func gormColumnName(field reflect.StructField) string {
+	for _, setting := range strings.Split(field.Tag.Get("gorm"), ";") {
+		name, value, ok := strings.Cut(setting, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "column") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return toSnakeCase(field.Name)
+}
+
+// toSnakeCase converts a Go identifier into snake case, keeping
+// initialisms together, e.g. "UserID" becomes "user_id" and
+// "HTTPServer" becomes "http_server".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var builder strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+					builder.WriteByte('_')
+				}
+			}
+			builder.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
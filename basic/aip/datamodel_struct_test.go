@@ -0,0 +1,123 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type structTableBase struct {
+	ID         uint64    `aip:"path=name,filter,sort"`
+	CreateTime time.Time `aip:"filter,sort,output_only"`
+}
+
+type structTableBook struct {
+	structTableBase
+	DisplayName string            `aip:"implicit,sort,update" gorm:"column:title;size:255"`
+	Author      sql.NullString    `aip:"filter"`
+	Published   *bool             `aip:"filter"`
+	Rating      float32           `aip:"path=stats.rating,filter"`
+	ReadTime    time.Duration     `aip:"filter"`
+	Labels      map[string]string `aip:"filter"`
+	Tags        []string          `aip:"filter"`
+	Scores      []int32           `aip:"filter"`
+	Spec        map[string]any    `aip:"filter,json"`
+	Ignored     string            `aip:"-"`
+	Untagged    string
+}
+
+func TestTableFromStruct(t *testing.T) {
+	Convey("TableFromStruct", t, func() {
+		Convey("Valid struct", func() {
+			table, err := TableFromStruct(&structTableBook{})
+			So(err, ShouldBeNil)
+			So(table.columns, ShouldResemble, []*Column{
+				NewColumn().WithFieldPath("name").WithDatabaseName("id").Int64().Filterable().Sortable().Build(),
+				NewColumn().WithFieldPath("create_time").WithDatabaseName("create_time").Timestamp().Filterable().Sortable().OutputOnly().Build(),
+				NewColumn().WithFieldPath("display_name").WithDatabaseName("title").FilterableImplicitly().Sortable().Updatable().Build(),
+				NewColumn().WithFieldPath("author").WithDatabaseName("author").Filterable().Build(),
+				NewColumn().WithFieldPath("published").WithDatabaseName("published").Bool().Filterable().Build(),
+				NewColumn().WithFieldPath("stats", "rating").WithDatabaseName("rating").Float64().Filterable().Build(),
+				NewColumn().WithFieldPath("read_time").WithDatabaseName("read_time").Duration().Filterable().Build(),
+				NewColumn().WithFieldPath("labels").WithDatabaseName("labels").KeyValue().Filterable().Build(),
+				NewColumn().WithFieldPath("tags").WithDatabaseName("tags").Repeated().Filterable().Build(),
+				NewColumn().WithFieldPath("scores").WithDatabaseName("scores").Int64().Repeated().Filterable().Build(),
+				NewColumn().WithFieldPath("spec").WithDatabaseName("spec").JSON().Filterable().Build(),
+			})
+		})
+		Convey("Type override", func() {
+			type row struct {
+				Version []byte `aip:"filter,type=string"`
+			}
+			table, err := TableFromStruct(row{})
+			So(err, ShouldBeNil)
+			So(table.columns, ShouldResemble, []*Column{
+				NewColumn().WithFieldPath("version").WithDatabaseName("version").Filterable().Build(),
+			})
+		})
+		Convey("Duplicate field paths", func() {
+			type row struct {
+				A string `aip:"path=a"`
+				B string `aip:"path=a"`
+			}
+			_, err := TableFromStruct(row{})
+			So(err, ShouldErrLike, "multiple columns with the same field path: a")
+		})
+		Convey("Unknown option", func() {
+			type row struct {
+				A string `aip:"filterable"`
+			}
+			_, err := TableFromStruct(row{})
+			So(err, ShouldErrLike, "field A: unknown aip tag option \"filterable\"")
+		})
+		Convey("Uninferable type", func() {
+			type row struct {
+				A chan int `aip:"filter"`
+			}
+			_, err := TableFromStruct(row{})
+			So(err, ShouldErrLike, "field A: unable to infer column type of chan int")
+		})
+		Convey("Sortable repeated field", func() {
+			type row struct {
+				Tags []string `aip:"filter,sort"`
+			}
+			_, err := TableFromStruct(row{})
+			So(err, ShouldErrLike, "repeated column cannot be sortable: tags")
+		})
+		Convey("Sortable JSON field", func() {
+			type row struct {
+				Spec []byte `aip:"json,sort"`
+			}
+			_, err := TableFromStruct(row{})
+			So(err, ShouldErrLike, "JSON column cannot be sortable: spec")
+		})
+		Convey("Not a struct", func() {
+			_, err := TableFromStruct("book")
+			So(err, ShouldErrLike, "expected a struct but got string")
+		})
+	})
+	Convey("toSnakeCase", t, func() {
+		So(toSnakeCase("ID"), ShouldEqual, "id")
+		So(toSnakeCase("UserID"), ShouldEqual, "user_id")
+		So(toSnakeCase("HTTPServer"), ShouldEqual, "http_server")
+		So(toSnakeCase("CreateTime"), ShouldEqual, "create_time")
+		So(toSnakeCase("Field2Name"), ShouldEqual, "field2_name")
+	})
+}
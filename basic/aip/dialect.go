@@ -0,0 +1,342 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Dialect controls the flavour of SQL generated by a Table.
+//
+// All methods receive and return injection-safe SQL fragments: column
+// names come from the Table definition and values are always placeholders.
+type Dialect interface {
+	// Placeholder returns the SQL placeholder referencing the query parameter
+	// with the given name. index is the 1-based position of the parameter
+	// amongst the parameters of the query, see Table.WithParameterOffset.
+	Placeholder(name string, index int) string
+
+	// Positional returns whether placeholders are bound by their position
+	// in the SQL text rather than by name. Parameters which are referenced
+	// several times are bound once per reference in positional dialects.
+	Positional() bool
+
+	// QuoteIdentifier quotes the database name of a column.
+	QuoteIdentifier(name string) string
+
+	// Order returns the ORDER BY item ordering by expr, in descending
+	// order if descending is set. NULLs sort first in ascending order and
+	// last in descending order, i.e. as the smallest values.
+	Order(expr string, descending bool) string
+
+	// Like returns a boolean expression matching expr against pattern,
+	// where pattern evaluates to a LIKE pattern escaped with QuoteLike.
+	Like(expr, pattern string) string
+
+	// KeyValue returns a boolean expression that holds if the key value
+	// column contains an entry for key whose value satisfies predicate.
+	// The predicate is called with an expression evaluating to the value.
+	// The expression is FALSE rather than NULL if there is no entry for
+	// key, so that its negation holds for rows without the key.
+	KeyValue(column, key string, predicate func(value string) string) string
+
+	// HasKey returns a boolean expression that holds if the key value
+	// column contains an entry for key, whatever its value.
+	HasKey(column, key string) string
+
+	// Contains returns a boolean expression that holds if the repeated
+	// column contains an element equal to element, of the given column type.
+	Contains(column, element string, columnType ColumnType) string
+
+	// JSONValue returns an expression evaluating to the value at the path
+	// of the JSON column, of the given column type, or NULL if there is no
+	// such value or it is not of the JSON type matching the column type.
+	// The path elements are expressions evaluating to the keys of the path.
+	JSONValue(column string, path []string, columnType ColumnType) string
+}
+
+var (
+	// Spanner generates GoogleSQL for Cloud Spanner. Key value columns are
+	// arrays of STRUCT<key STRING, value STRING>, repeated columns are
+	// arrays and JSON columns have the JSON type.
+	Spanner Dialect = googleSQLDialect{quote: "`"}
+
+	// BigQuery generates GoogleSQL for BigQuery. Key value columns are
+	// arrays of STRUCT<key STRING, value STRING>, repeated columns are
+	// arrays and JSON columns have the JSON type.
+	BigQuery Dialect = googleSQLDialect{quote: "`"}
+
+	// MySQL generates SQL for MySQL. Key value columns are JSON objects
+	// with string values, repeated columns are JSON arrays and JSON columns
+	// have the JSON type.
+	MySQL Dialect = mysqlDialect{}
+
+	// PostgreSQL generates SQL for PostgreSQL. Key value columns are
+	// jsonb objects with string values, repeated columns are arrays and
+	// JSON columns have the jsonb type. JSON values of the right JSON type
+	// which cannot be converted to the column type, such as fractional
+	// numbers for INT64 columns or strings which are not timestamps for
+	// TIMESTAMP columns, fail the query rather than evaluating to NULL.
+	PostgreSQL Dialect = postgreSQLDialect{}
+
+	// SQLite generates SQL for SQLite. Key value columns are JSON objects
+	// with string values, repeated columns are JSON arrays and JSON columns
+	// hold JSON text.
+	SQLite Dialect = sqliteDialect{}
+
+	// defaultDialect is used by tables built without a dialect. It generates
+	// GoogleSQL with unquoted column names.
+	defaultDialect Dialect = googleSQLDialect{}
+)
+
+// identifierRE matches column names which are (optionally qualified)
+// plain identifiers. Other database names, such as expressions, are
+// never quoted.
+var identifierRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9]*(\.[a-zA-Z_][a-zA-Z_0-9]*)*$`)
+
+// quoteIdentifier quotes each part of a (qualified) identifier with the
+// given quote character.
+func quoteIdentifier(name string, quote string) string {
+	if quote == "" || !identifierRE.MatchString(name) {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quote + part + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+// nullsFirstOrder returns the ORDER BY item ordering by expr in dialects where
+// NULLs are the smallest values by default.
+func nullsFirstOrder(expr string, descending bool) string {
+	if descending {
+		return expr + " DESC"
+	}
+	return expr
+}
+
+type googleSQLDialect struct {
+	quote string
+}
+
+func (d googleSQLDialect) Placeholder(name string, _ int) string {
+	return "@" + name
+}
+
+func (d googleSQLDialect) Positional() bool {
+	return false
+}
+
+func (d googleSQLDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, d.quote)
+}
+
+func (d googleSQLDialect) Order(expr string, descending bool) string {
+	return nullsFirstOrder(expr, descending)
+}
+
+func (d googleSQLDialect) Like(expr, pattern string) string {
+	return fmt.Sprintf("%s LIKE %s", expr, pattern)
+}
+
+func (d googleSQLDialect) KeyValue(column, key string, predicate func(value string) string) string {
+	return fmt.Sprintf("EXISTS (SELECT key, value FROM UNNEST(%s) WHERE key = %s AND %s)", column, key, predicate("value"))
+}
+
+func (d googleSQLDialect) HasKey(column, key string) string {
+	return fmt.Sprintf("EXISTS (SELECT key FROM UNNEST(%s) WHERE key = %s)", column, key)
+}
+
+func (d googleSQLDialect) Contains(column, element string, _ ColumnType) string {
+	return fmt.Sprintf("%s IN UNNEST(%s)", element, column)
+}
+
+func (d googleSQLDialect) JSONValue(column string, path []string, columnType ColumnType) string {
+	value := fmt.Sprintf("JSON_VALUE(%s[%s])", column, strings.Join(path, "]["))
+	switch columnType {
+	case ColumnTypeBool:
+		return fmt.Sprintf("SAFE_CAST(%s AS BOOL)", value)
+	case ColumnTypeInt64:
+		return fmt.Sprintf("SAFE_CAST(%s AS INT64)", value)
+	case ColumnTypeFloat64:
+		return fmt.Sprintf("SAFE_CAST(%s AS FLOAT64)", value)
+	case ColumnTypeTimestamp:
+		return fmt.Sprintf("SAFE_CAST(%s AS TIMESTAMP)", value)
+	}
+	return value
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Placeholder(string, int) string {
+	return "?"
+}
+
+func (mysqlDialect) Positional() bool {
+	return true
+}
+
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, "`")
+}
+
+func (mysqlDialect) Order(expr string, descending bool) string {
+	return nullsFirstOrder(expr, descending)
+}
+
+func (mysqlDialect) Like(expr, pattern string) string {
+	return fmt.Sprintf("%s LIKE %s", expr, pattern)
+}
+
+func (mysqlDialect) KeyValue(column, key string, predicate func(value string) string) string {
+	// JSON_QUOTE turns the user supplied key into a valid path member. The
+	// value is NULL if there is no such key, which COALESCE maps to FALSE.
+	return fmt.Sprintf("COALESCE(%s, FALSE)", predicate(fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, CONCAT('$.', JSON_QUOTE(%s))))", column, key)))
+}
+
+func (mysqlDialect) HasKey(column, key string) string {
+	return fmt.Sprintf("JSON_CONTAINS_PATH(%s, 'one', CONCAT('$.', JSON_QUOTE(%s)))", column, key)
+}
+
+func (mysqlDialect) Contains(column, element string, columnType ColumnType) string {
+	if columnType == ColumnTypeBool {
+		// MySQL booleans are integers, which JSON_ARRAY would convert to 1
+		// or 0 rather than to JSON true or false.
+		return fmt.Sprintf("JSON_CONTAINS(%s, IF(%s, 'true', 'false'))", column, element)
+	}
+	// JSON_ARRAY converts the element to a JSON value of its SQL type.
+	return fmt.Sprintf("JSON_CONTAINS(%s, JSON_ARRAY(%s))", column, element)
+}
+
+func (mysqlDialect) JSONValue(column string, path []string, columnType ColumnType) string {
+	// JSON_QUOTE turns the user supplied keys into valid path members.
+	value := fmt.Sprintf("JSON_EXTRACT(%s, CONCAT('$.', JSON_QUOTE(%s)))", column, strings.Join(path, "), '.', JSON_QUOTE("))
+	switch columnType {
+	case ColumnTypeBool:
+		// JSON booleans compare equal to TRUE and FALSE.
+		return value
+	case ColumnTypeInt64:
+		return fmt.Sprintf("CAST(%s AS SIGNED)", value)
+	case ColumnTypeFloat64:
+		return fmt.Sprintf("CAST(%s AS DOUBLE)", value)
+	case ColumnTypeTimestamp:
+		return fmt.Sprintf("CAST(JSON_UNQUOTE(%s) AS DATETIME(6))", value)
+	}
+	return fmt.Sprintf("JSON_UNQUOTE(%s)", value)
+}
+
+type postgreSQLDialect struct{}
+
+func (postgreSQLDialect) Placeholder(_ string, index int) string {
+	return fmt.Sprintf("$%d", index)
+}
+
+func (postgreSQLDialect) Positional() bool {
+	return false
+}
+
+func (postgreSQLDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`)
+}
+
+func (postgreSQLDialect) Order(expr string, descending bool) string {
+	// Unlike the other dialects, NULLs are the largest values by default.
+	if descending {
+		return expr + " DESC NULLS LAST"
+	}
+	return expr + " NULLS FIRST"
+}
+
+func (postgreSQLDialect) Like(expr, pattern string) string {
+	return fmt.Sprintf("%s LIKE %s", expr, pattern)
+}
+
+func (postgreSQLDialect) KeyValue(column, key string, predicate func(value string) string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_each_text(%s) WHERE key = %s AND %s)", column, key, predicate("value"))
+}
+
+func (postgreSQLDialect) HasKey(column, key string) string {
+	// jsonb_exists is the function behind the ? operator, which would be
+	// mistaken for a positional placeholder, e.g. by GORM.
+	return fmt.Sprintf("jsonb_exists(%s, %s)", column, key)
+}
+
+func (postgreSQLDialect) Contains(column, element string, _ ColumnType) string {
+	return fmt.Sprintf("%s = ANY(%s)", element, column)
+}
+
+func (postgreSQLDialect) JSONValue(column string, path []string, columnType ColumnType) string {
+	keys := strings.Join(path, ", ")
+	value := fmt.Sprintf("jsonb_extract_path_text(%s, %s)", column, keys)
+	var sqlType, jsonType string
+	switch columnType {
+	case ColumnTypeBool:
+		sqlType, jsonType = "BOOLEAN", "boolean"
+	case ColumnTypeInt64:
+		sqlType, jsonType = "BIGINT", "number"
+	case ColumnTypeFloat64:
+		sqlType, jsonType = "DOUBLE PRECISION", "number"
+	case ColumnTypeTimestamp:
+		sqlType, jsonType = "TIMESTAMPTZ", "string"
+	default:
+		return value
+	}
+	// Unlike SAFE_CAST, CAST fails the query on values it cannot convert,
+	// so values of other JSON types are mapped to NULL first.
+	return fmt.Sprintf("CASE WHEN jsonb_typeof(jsonb_extract_path(%s, %s)) = '%s' THEN CAST(%s AS %s) END", column, keys, jsonType, value, sqlType)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Placeholder(string, int) string {
+	return "?"
+}
+
+func (sqliteDialect) Positional() bool {
+	return true
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`)
+}
+
+func (sqliteDialect) Order(expr string, descending bool) string {
+	return nullsFirstOrder(expr, descending)
+}
+
+func (sqliteDialect) Like(expr, pattern string) string {
+	// SQLite has no default escape character for LIKE.
+	return fmt.Sprintf("%s LIKE %s ESCAPE '\\'", expr, pattern)
+}
+
+func (sqliteDialect) KeyValue(column, key string, predicate func(value string) string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE key = %s AND %s)", column, key, predicate("value"))
+}
+
+func (sqliteDialect) HasKey(column, key string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE key = %s)", column, key)
+}
+
+func (sqliteDialect) Contains(column, element string, _ ColumnType) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE value = %s)", column, element)
+}
+
+func (sqliteDialect) JSONValue(column string, path []string, _ ColumnType) string {
+	// json_extract returns values of the SQL type matching their JSON type.
+	return fmt.Sprintf("json_extract(%s, '$.' || json_quote(%s))", column, strings.Join(path, ") || '.' || json_quote("))
+}
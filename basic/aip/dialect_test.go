@@ -0,0 +1,219 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDialect(t *testing.T) {
+	Convey("Dialect", t, func() {
+		columns := []*Column{
+			NewColumn().WithFieldPath("foo").WithDatabaseName("t.db_foo").FilterableImplicitly().Sortable().Build(),
+			NewColumn().WithFieldPath("bar").WithDatabaseName("db_bar").FilterableImplicitly().Build(),
+			NewColumn().WithFieldPath("kv").WithDatabaseName("db_kv").KeyValue().Filterable().Build(),
+			NewColumn().WithFieldPath("tags").WithDatabaseName("db_tags").Repeated().Filterable().Build(),
+			NewColumn().WithFieldPath("flags").WithDatabaseName("db_flags").Bool().Repeated().Filterable().Build(),
+			NewColumn().WithFieldPath("spec").WithDatabaseName("db_spec").JSON().Filterable().Build(),
+			NewColumn().WithFieldPath("spec", "replicas").WithDatabaseName("db_spec").JSON("replicas").Int64().Filterable().Build(),
+			NewColumn().WithFieldPath("expr").WithDatabaseName("LOWER(db_expr)").Filterable().Sortable().Build(),
+		}
+		filter, err := ParseFilter("implicit kv.key=somevalue expr:x")
+		So(err, ShouldBeNil)
+		order := []OrderBy{
+			{FieldPath: NewFieldPath("foo"), Descending: true},
+			{FieldPath: NewFieldPath("expr")},
+		}
+
+		test := func(dialect Dialect, expectedWhere string, expectedPars []QueryParameter, expectedOrder string) {
+			table := NewTable().WithColumns(columns...).WithDialect(dialect).Build()
+			result, pars, err := table.WhereClause(filter, "p_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, expectedWhere)
+			So(pars, ShouldResemble, expectedPars)
+
+			orderBy, err := table.OrderByClause(order)
+			So(err, ShouldBeNil)
+			So(orderBy, ShouldEqual, expectedOrder)
+		}
+
+		Convey("Default", func() {
+			test(nil,
+				"((t.db_foo LIKE @p_0 OR db_bar LIKE @p_0) AND (EXISTS (SELECT key, value FROM UNNEST(db_kv) WHERE key = @p_1 AND value = @p_2)) AND (LOWER(db_expr) LIKE @p_3))",
+				[]QueryParameter{
+					{Name: "p_0", Value: "%implicit%"},
+					{Name: "p_1", Value: "key"},
+					{Name: "p_2", Value: "somevalue"},
+					{Name: "p_3", Value: "%x%"},
+				},
+				"t.db_foo DESC, LOWER(db_expr)")
+		})
+		Convey("Spanner", func() {
+			test(Spanner,
+				"((`t`.`db_foo` LIKE @p_0 OR `db_bar` LIKE @p_0) AND (EXISTS (SELECT key, value FROM UNNEST(`db_kv`) WHERE key = @p_1 AND value = @p_2)) AND (LOWER(db_expr) LIKE @p_3))",
+				[]QueryParameter{
+					{Name: "p_0", Value: "%implicit%"},
+					{Name: "p_1", Value: "key"},
+					{Name: "p_2", Value: "somevalue"},
+					{Name: "p_3", Value: "%x%"},
+				},
+				"`t`.`db_foo` DESC, LOWER(db_expr)")
+		})
+		Convey("MySQL", func() {
+			test(MySQL,
+				"((`t`.`db_foo` LIKE ? OR `db_bar` LIKE ?) AND (COALESCE(JSON_UNQUOTE(JSON_EXTRACT(`db_kv`, CONCAT('$.', JSON_QUOTE(?)))) = ?, FALSE)) AND (LOWER(db_expr) LIKE ?))",
+				[]QueryParameter{
+					{Name: "p_0", Value: "%implicit%"},
+					{Name: "p_1", Value: "%implicit%"},
+					{Name: "p_2", Value: "key"},
+					{Name: "p_3", Value: "somevalue"},
+					{Name: "p_4", Value: "%x%"},
+				},
+				"`t`.`db_foo` DESC, LOWER(db_expr)")
+		})
+		Convey("PostgreSQL", func() {
+			test(PostgreSQL,
+				`(("t"."db_foo" LIKE $1 OR "db_bar" LIKE $1) AND (EXISTS (SELECT 1 FROM jsonb_each_text("db_kv") WHERE key = $2 AND value = $3)) AND (LOWER(db_expr) LIKE $4))`,
+				[]QueryParameter{
+					{Name: "p_0", Value: "%implicit%"},
+					{Name: "p_1", Value: "key"},
+					{Name: "p_2", Value: "somevalue"},
+					{Name: "p_3", Value: "%x%"},
+				},
+				`"t"."db_foo" DESC NULLS LAST, LOWER(db_expr) NULLS FIRST`)
+		})
+		Convey("PostgreSQL combined clauses", func() {
+			table := NewTable().WithColumns(
+				NewColumn().WithFieldPath("name").WithDatabaseName("name").Filterable().Sortable().Updatable().Build(),
+				NewColumn().WithFieldPath("id").WithDatabaseName("id").Int64().Filterable().Sortable().Build(),
+			).WithTieBreaker("id").WithDialect(PostgreSQL).Build()
+			filter, err := ParseFilter("name = x")
+			So(err, ShouldBeNil)
+			mask, err := ParseFieldMask("name")
+			So(err, ShouldBeNil)
+
+			set, setPars, err := table.UpdateClause(mask, map[string]any{"name": "y"}, "u_")
+			So(err, ShouldBeNil)
+			So(set, ShouldEqual, `SET "name" = $1`)
+			where, wherePars, err := table.WithParameterOffset(len(setPars)).WhereClause(filter, "p_")
+			So(err, ShouldBeNil)
+			So(where, ShouldEqual, `("name" = $2)`)
+			order := []OrderBy{{FieldPath: NewFieldPath("name")}}
+			keyset, keysetPars, err := table.WithParameterOffset(len(setPars)+len(wherePars)).KeysetClause(order, map[string]any{"name": "a", "id": 1}, "k_")
+			So(err, ShouldBeNil)
+			So(keyset, ShouldEqual, `(("name" > $3) OR ("name" = $3 AND "id" > $4))`)
+
+			pars := append(append(setPars, wherePars...), keysetPars...)
+			So(PositionalArgs(pars), ShouldResemble, []any{"y", "x", "a", int64(1)})
+		})
+		Convey("Key presence", func() {
+			filter, err := ParseFilter("kv:env OR kv.lang:*")
+			So(err, ShouldBeNil)
+			test := func(dialect Dialect, expected string) {
+				table := NewTable().WithColumns(columns...).WithDialect(dialect).Build()
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, expected)
+				So(pars, ShouldResemble, []QueryParameter{{Name: "p_0", Value: "env"}, {Name: "p_1", Value: "lang"}})
+			}
+			test(Spanner, "((EXISTS (SELECT key FROM UNNEST(`db_kv`) WHERE key = @p_0)) OR (EXISTS (SELECT key FROM UNNEST(`db_kv`) WHERE key = @p_1)))")
+			test(MySQL, "((JSON_CONTAINS_PATH(`db_kv`, 'one', CONCAT('$.', JSON_QUOTE(?)))) OR (JSON_CONTAINS_PATH(`db_kv`, 'one', CONCAT('$.', JSON_QUOTE(?)))))")
+			test(PostgreSQL, `((jsonb_exists("db_kv", $1)) OR (jsonb_exists("db_kv", $2)))`)
+			test(SQLite, `((EXISTS (SELECT 1 FROM json_each("db_kv") WHERE key = ?)) OR (EXISTS (SELECT 1 FROM json_each("db_kv") WHERE key = ?)))`)
+		})
+		Convey("Negated key value restriction", func() {
+			filter, err := ParseFilter(`-kv.env = "prod"`)
+			So(err, ShouldBeNil)
+			test := func(dialect Dialect, expected string) {
+				table := NewTable().WithColumns(columns...).WithDialect(dialect).Build()
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, expected)
+				So(pars, ShouldResemble, []QueryParameter{{Name: "p_0", Value: "env"}, {Name: "p_1", Value: "prod"}})
+			}
+			// Rows without the key match the negation in every dialect.
+			test(Spanner, "(NOT (EXISTS (SELECT key, value FROM UNNEST(`db_kv`) WHERE key = @p_0 AND value = @p_1)))")
+			test(MySQL, "(NOT (COALESCE(JSON_UNQUOTE(JSON_EXTRACT(`db_kv`, CONCAT('$.', JSON_QUOTE(?)))) = ?, FALSE)))")
+			test(PostgreSQL, `(NOT (EXISTS (SELECT 1 FROM jsonb_each_text("db_kv") WHERE key = $1 AND value = $2)))`)
+			test(SQLite, `(NOT (EXISTS (SELECT 1 FROM json_each("db_kv") WHERE key = ? AND value = ?)))`)
+		})
+		Convey("Element containment", func() {
+			filter, err := ParseFilter("tags:urgent")
+			So(err, ShouldBeNil)
+			test := func(dialect Dialect, expected string) {
+				table := NewTable().WithColumns(columns...).WithDialect(dialect).Build()
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, expected)
+				So(pars, ShouldResemble, []QueryParameter{{Name: "p_0", Value: "urgent"}})
+			}
+			test(Spanner, "(@p_0 IN UNNEST(`db_tags`))")
+			test(MySQL, "(JSON_CONTAINS(`db_tags`, JSON_ARRAY(?)))")
+			test(PostgreSQL, `($1 = ANY("db_tags"))`)
+			test(SQLite, `(EXISTS (SELECT 1 FROM json_each("db_tags") WHERE value = ?))`)
+		})
+		Convey("Boolean element containment", func() {
+			filter, err := ParseFilter("flags:true")
+			So(err, ShouldBeNil)
+			test := func(dialect Dialect, expected string) {
+				table := NewTable().WithColumns(columns...).WithDialect(dialect).Build()
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, expected)
+				So(pars, ShouldBeEmpty)
+			}
+			test(Spanner, "(TRUE IN UNNEST(`db_flags`))")
+			// JSON_ARRAY(TRUE) would be [1], which does not contain JSON true.
+			test(MySQL, "(JSON_CONTAINS(`db_flags`, IF(TRUE, 'true', 'false')))")
+			test(PostgreSQL, `(TRUE = ANY("db_flags"))`)
+			test(SQLite, `(EXISTS (SELECT 1 FROM json_each("db_flags") WHERE value = TRUE))`)
+		})
+		Convey("JSON values", func() {
+			filter, err := ParseFilter(`spec.owner.team = "x" AND spec.replicas > 2`)
+			So(err, ShouldBeNil)
+			test := func(dialect Dialect, expected string) {
+				table := NewTable().WithColumns(columns...).WithDialect(dialect).Build()
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, expected)
+				So(pars, ShouldResemble, []QueryParameter{
+					{Name: "p_0", Value: "owner"},
+					{Name: "p_1", Value: "team"},
+					{Name: "p_2", Value: "x"},
+					{Name: "p_3", Value: "replicas"},
+					{Name: "p_4", Value: int64(2)},
+				})
+			}
+			test(Spanner, "((JSON_VALUE(`db_spec`[@p_0][@p_1]) = @p_2) AND (SAFE_CAST(JSON_VALUE(`db_spec`[@p_3]) AS INT64) > @p_4))")
+			test(MySQL, "((JSON_UNQUOTE(JSON_EXTRACT(`db_spec`, CONCAT('$.', JSON_QUOTE(?), '.', JSON_QUOTE(?)))) = ?) AND (CAST(JSON_EXTRACT(`db_spec`, CONCAT('$.', JSON_QUOTE(?))) AS SIGNED) > ?))")
+			test(PostgreSQL, `((jsonb_extract_path_text("db_spec", $1, $2) = $3) AND (CASE WHEN jsonb_typeof(jsonb_extract_path("db_spec", $4)) = 'number' THEN CAST(jsonb_extract_path_text("db_spec", $4) AS BIGINT) END > $5))`)
+			test(SQLite, `((json_extract("db_spec", '$.' || json_quote(?) || '.' || json_quote(?)) = ?) AND (json_extract("db_spec", '$.' || json_quote(?)) > ?))`)
+		})
+		Convey("SQLite", func() {
+			test(SQLite,
+				`(("t"."db_foo" LIKE ? ESCAPE '\' OR "db_bar" LIKE ? ESCAPE '\') AND (EXISTS (SELECT 1 FROM json_each("db_kv") WHERE key = ? AND value = ?)) AND (LOWER(db_expr) LIKE ? ESCAPE '\'))`,
+				[]QueryParameter{
+					{Name: "p_0", Value: "%implicit%"},
+					{Name: "p_1", Value: "%implicit%"},
+					{Name: "p_2", Value: "key"},
+					{Name: "p_3", Value: "somevalue"},
+					{Name: "p_4", Value: "%x%"},
+				},
+				`"t"."db_foo" DESC, LOWER(db_expr)`)
+		})
+	})
+}
@@ -0,0 +1,332 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+// This file resolves field paths against Go values, for the in-memory
+// evaluation of filters and orderings.
+//
+// Field path segments are matched against:
+//   - struct fields, by the path of their `aip` tag, their `json` tag name,
+//     their snake case name or their Go name. Fields of embedded structs
+//     are promoted.
+//   - keys of maps with string keys.
+//   - fields of proto messages, by proto name or JSON name.
+//   - keys of JSON objects held in strings or byte slices, e.g. the
+//     json.RawMessage value of a JSON column.
+//
+// Resolved values are normalized: integers become int64, floats become
+// float64, named string and bool types become string and bool, proto
+// enums become the name of their value, google.protobuf.Timestamp and
+// Duration become time.Time and time.Duration, wrapper messages become
+// their value and driver.Valuer types (e.g. sql.NullString) become their
+// driver value. Nil pointers, unset message fields and missing map keys
+// are reported as missing.
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldValue returns the normalized value of the field with the given
+// path segments in v, and whether it is present.
+func fieldValue(v any, segments []string) (any, bool) {
+	v, ok := normalizeValue(v)
+	if !ok {
+		return nil, false
+	}
+	if len(segments) == 0 {
+		return v, true
+	}
+	if m, ok := v.(proto.Message); ok {
+		return protoFieldValue(m.ProtoReflect(), segments)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		elem := rv.MapIndex(reflect.ValueOf(segments[0]).Convert(rv.Type().Key()))
+		if !elem.IsValid() {
+			return nil, false
+		}
+		return fieldValue(elem.Interface(), segments[1:])
+	case reflect.Struct:
+		for _, field := range structFieldPaths(rv.Type()) {
+			for _, path := range field.paths {
+				if hasPathPrefix(segments, path) {
+					return fieldValue(rv.FieldByIndex(field.index).Interface(), segments[len(path):])
+				}
+			}
+		}
+	case reflect.String, reflect.Slice:
+		if doc, ok := jsonObject(rv); ok {
+			return fieldValue(doc, segments)
+		}
+	}
+	return nil, false
+}
+
+// jsonObject decodes the JSON object held in a string or byte slice.
+func jsonObject(rv reflect.Value) (map[string]any, bool) {
+	var data []byte
+	switch {
+	case rv.Kind() == reflect.String:
+		data = []byte(rv.String())
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		data = rv.Bytes()
+	default:
+		return nil, false
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil || doc == nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+func hasPathPrefix(segments, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for i, segment := range prefix {
+		if segments[i] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// structFieldPath holds the paths by which a struct field can be referenced.
+type structFieldPath struct {
+	index []int
+	paths [][]string
+}
+
+// structFieldPathsCache caches the structFieldPath of each struct type.
+var structFieldPathsCache sync.Map
+
+// structFieldPaths returns the paths of the exported fields of the struct type,
+// including the promoted fields of embedded structs.
+func structFieldPaths(t reflect.Type) []structFieldPath {
+	if cached, ok := structFieldPathsCache.Load(t); ok {
+		return cached.([]structFieldPath)
+	}
+	var result []structFieldPath
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		var paths [][]string
+		tag, tagged := field.Tag.Lookup("aip")
+		if tag == "-" {
+			continue
+		}
+		if tagged {
+			for _, option := range strings.Split(tag, ",") {
+				if path, ok := strings.CutPrefix(strings.TrimSpace(option), "path="); ok && path != "" {
+					paths = append(paths, strings.Split(path, "."))
+				}
+			}
+		}
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+			paths = append(paths, []string{name})
+		}
+		paths = append(paths, []string{toSnakeCase(field.Name)}, []string{field.Name})
+		result = append(result, structFieldPath{index: field.Index, paths: paths})
+	}
+	structFieldPathsCache.Store(t, result)
+	return result
+}
+
+func protoFieldValue(m protoreflect.Message, segments []string) (any, bool) {
+	fields := m.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(segments[0]))
+	if fd == nil {
+		fd = fields.ByJSONName(segments[0])
+	}
+	if fd == nil {
+		return nil, false
+	}
+	if fd.HasPresence() && !m.Has(fd) {
+		return nil, false
+	}
+	value := m.Get(fd)
+	var result any
+	switch {
+	case fd.IsList():
+		list := value.List()
+		elems := make([]any, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			elems = append(elems, protoSingularValue(fd, list.Get(i)))
+		}
+		result = elems
+	case fd.IsMap():
+		entries := make(map[string]any, value.Map().Len())
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			entries[key.String()] = protoSingularValue(fd.MapValue(), value)
+			return true
+		})
+		result = entries
+	default:
+		result = protoSingularValue(fd, value)
+	}
+	return fieldValue(result, segments[1:])
+}
+
+func protoSingularValue(fd protoreflect.FieldDescriptor, value protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if v := fd.Enum().Values().ByNumber(value.Enum()); v != nil {
+			return string(v.Name())
+		}
+		return int64(value.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return value.Message().Interface()
+	}
+	return value.Interface()
+}
+
+// normalizeMessage normalizes well-known proto messages to their Go values.
+// Messages are matched by name to support dynamic messages.
+func normalizeMessage(m protoreflect.Message) (any, bool) {
+	fields := m.Descriptor().Fields()
+	switch m.Descriptor().FullName() {
+	case "google.protobuf.Timestamp":
+		seconds := m.Get(fields.ByName("seconds")).Int()
+		nanos := m.Get(fields.ByName("nanos")).Int()
+		return time.Unix(seconds, nanos).UTC(), true
+	case "google.protobuf.Duration":
+		seconds := m.Get(fields.ByName("seconds")).Int()
+		nanos := m.Get(fields.ByName("nanos")).Int()
+		return time.Duration(seconds)*time.Second + time.Duration(nanos), true
+	case "google.protobuf.StringValue", "google.protobuf.BoolValue",
+		"google.protobuf.Int32Value", "google.protobuf.Int64Value",
+		"google.protobuf.UInt32Value", "google.protobuf.UInt64Value",
+		"google.protobuf.FloatValue", "google.protobuf.DoubleValue",
+		"google.protobuf.BytesValue":
+		fd := fields.ByName("value")
+		return normalizeValue(protoSingularValue(fd, m.Get(fd)))
+	}
+	return m.Interface(), true
+}
+
+// normalizeValue normalizes a Go value as described at the top of this file.
+func normalizeValue(v any) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		if _, ok := rv.Interface().(proto.Message); ok {
+			break
+		}
+		rv = rv.Elem()
+	}
+	v = rv.Interface()
+
+	switch x := v.(type) {
+	case proto.Message:
+		return normalizeMessage(x.ProtoReflect())
+	case driver.Valuer:
+		value, err := x.Value()
+		if err != nil || value == nil {
+			return nil, false
+		}
+		if reflect.TypeOf(value) == rv.Type() {
+			// Avoid infinite recursion on types returning themselves.
+			break
+		}
+		return normalizeValue(value)
+	}
+
+	switch rv.Type() {
+	case timeType:
+		return v, true
+	case durationType:
+		return time.Duration(rv.Int()), true
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Bool:
+		return rv.Bool(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), true
+		}
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return v, true
+}
+
+// columnValue converts a value normalized by normalizeValue to the Go type
+// of the column, as documented on QueryParameter.Value.
+func columnValue(column *Column, value any) (any, error) {
+	switch column.columnType {
+	case ColumnTypeString:
+		switch x := value.(type) {
+		case string:
+			return x, nil
+		case []byte:
+			return string(x), nil
+		}
+	case ColumnTypeBool:
+		if x, ok := value.(bool); ok {
+			return x, nil
+		}
+	case ColumnTypeInt64:
+		switch x := value.(type) {
+		case int64:
+			return x, nil
+		case float64:
+			if x == math.Trunc(x) && x >= math.MinInt64 && x < math.MaxInt64 {
+				return int64(x), nil
+			}
+		}
+	case ColumnTypeFloat64:
+		switch x := value.(type) {
+		case int64:
+			return float64(x), nil
+		case float64:
+			return x, nil
+		}
+	case ColumnTypeTimestamp:
+		if x, ok := value.(time.Time); ok {
+			return x, nil
+		}
+	case ColumnTypeDuration:
+		if x, ok := value.(time.Duration); ok {
+			return x, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of type %s but got %T", column.columnType.String(), value)
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SelectClause returns the comma-separated list of database columns
+// selected by an AIP-157 read_mask, e.g. "name, author_display_name",
+// in the order of the table columns. An empty or "*" mask selects all
+// columns.
+//
+// A path selects the column it refers to, the columns of the fields of
+// the message it refers to (e.g. "author" selects "author.display_name"),
+// a key value column if it refers to one of its keys (e.g.
+// "labels.env"), or a JSON column if it refers to one of its values (e.g.
+// "spec.replicas"). Each path must select at least one column, and
+// columns sharing a database column are selected once.
+//
+// The returned clause is safe against SQL injection; only
+// strings appearing from Table appear in the output.
+func (t *Table) SelectClause(mask FieldMask) (string, error) {
+	columns, err := t.columnsByFieldMask(mask)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(columns))
+	seen := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		// Columns may share a database column, e.g. the JSON columns
+		// declaring the types of the values of a document.
+		if _, ok := seen[column.databaseName]; ok {
+			continue
+		}
+		seen[column.databaseName] = struct{}{}
+		names = append(names, t.Dialect().QuoteIdentifier(column.databaseName))
+	}
+	return strings.Join(names, ", "), nil
+}
+
+// columnsByFieldMask returns the columns selected by the field mask, in
+// the order of the table columns.
+func (t *Table) columnsByFieldMask(mask FieldMask) ([]*Column, error) {
+	if mask.IsEmpty() || mask.All() {
+		return t.columns, nil
+	}
+	selected := make([]bool, len(t.columns))
+	for _, path := range mask.paths {
+		found := false
+		for i, column := range t.columns {
+			if path.matches(column) {
+				selected[i] = true
+				found = true
+			}
+		}
+		if !found {
+			columnNames := make([]string, 0, len(t.columns))
+			for _, column := range t.columns {
+				columnNames = append(columnNames, column.fieldPath.String())
+			}
+			return nil, fmt.Errorf("no field named %q, valid fields are %s", path.String(), strings.Join(columnNames, ", "))
+		}
+	}
+	var result []*Column
+	for i, column := range t.columns {
+		if selected[i] {
+			result = append(result, column)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSelectClause(t *testing.T) {
+	Convey("SelectClause", t, func() {
+		table := NewTable().WithColumns(
+			NewColumn().WithFieldPath("name").WithDatabaseName("db_name").Build(),
+			NewColumn().WithFieldPath("author", "display_name").WithDatabaseName("author_name").Build(),
+			NewColumn().WithFieldPath("author", "email").WithDatabaseName("author_email").Build(),
+			NewColumn().WithFieldPath("labels").WithDatabaseName("db_labels").KeyValue().Build(),
+		).Build()
+		selectClause := func(mask string) (string, error) {
+			m, err := ParseFieldMask(mask)
+			So(err, ShouldBeNil)
+			return table.SelectClause(m)
+		}
+
+		Convey("All columns", func() {
+			result, err := selectClause("")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "db_name, author_name, author_email, db_labels")
+
+			result, err = selectClause("*")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "db_name, author_name, author_email, db_labels")
+		})
+		Convey("Columns are selected in table order", func() {
+			result, err := selectClause("author.email, name")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "db_name, author_email")
+		})
+		Convey("Messages select their fields", func() {
+			result, err := selectClause("author")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "author_name, author_email")
+
+			result, err = selectClause("author.*")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "author_name, author_email")
+		})
+		Convey("Map keys select key value columns", func() {
+			result, err := selectClause("labels.env, labels.`a-b`")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "db_labels")
+
+			_, err = selectClause("labels.env.x")
+			So(err, ShouldErrLike, "no field named \"labels.env.x\"")
+		})
+		Convey("JSON values select JSON columns", func() {
+			table := NewTable().WithColumns(
+				NewColumn().WithFieldPath("spec").WithDatabaseName("db_spec").JSON().Build(),
+				NewColumn().WithFieldPath("spec", "replicas").WithDatabaseName("db_spec").JSON("replicas").Int64().Build(),
+			).Build()
+			for _, mask := range []string{"", "spec", "spec.owner.team", "spec.replicas"} {
+				m, err := ParseFieldMask(mask)
+				So(err, ShouldBeNil)
+				result, err := table.SelectClause(m)
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, "db_spec")
+			}
+		})
+		Convey("Dialect quoting", func() {
+			m, err := ParseFieldMask("name")
+			So(err, ShouldBeNil)
+			result, err := table.WithDialect(PostgreSQL).SelectClause(m)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, `"db_name"`)
+		})
+		Convey("Unknown paths", func() {
+			_, err := selectClause("name, title")
+			So(err, ShouldErrLike, "no field named \"title\", valid fields are name, author.display_name, author.email, labels")
+			_, err = selectClause("name.first")
+			So(err, ShouldErrLike, "no field named \"name.first\"")
+		})
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file provides a parser for AIP-161 field masks, as used in the
+// read_mask and update_mask fields of AIP-157 and AIP-134 requests.
+//
+// field_mask = "*" | field_path {[spaces] "," field_path} [spaces]
+// field_path = [spaces] segment {"." segment}
+// segment = "*" | string | quoted_string
+//
+// string and quoted_string are as defined for order by clauses. A "*"
+// segment matches any field or map key, e.g. "labels.*" or
+// "books.*.title"; a map key named "*" must be quoted: labels.`*`.
+//
+// Field paths are case-sensitive. No validation is performed to test that
+// the field paths are valid for a particular protocol buffer message.
+
+package aip
+
+import (
+	"strings"
+
+	participle "github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/pkg/errors"
+)
+
+var (
+	fieldMaskLexer = lexer.MustSimple([]lexer.SimpleRule{
+		{Name: "Spaces", Pattern: `[ ]+`},
+		{Name: "String", Pattern: `[a-zA-Z_][a-zA-Z_0-9]*`},
+		{Name: "QuotedString", Pattern: "`(``|[^`])*`"},
+		{Name: "Operators", Pattern: `[.,*]`},
+	})
+
+	fieldMaskParser = participle.MustBuild[fieldMaskList](participle.Lexer(fieldMaskLexer))
+)
+
+// FieldMask represents a parsed AIP-161 field mask.
+type FieldMask struct {
+	paths []maskPath
+}
+
+// maskPath is a field path of a field mask, which may contain wildcards.
+type maskPath struct {
+	segments []string
+	// Whether each segment is a "*" wildcard.
+	wildcards []bool
+}
+
+// ParseFieldMask parses an AIP-161 field mask, e.g. "display_name,author.*".
+// The method validates the syntax is correct and each path appears at
+// most once, but it does not validate the paths themselves are valid.
+//
+// An empty field mask yields an empty FieldMask; "*" yields a FieldMask
+// for which All reports true.
+func ParseFieldMask(text string) (FieldMask, error) {
+	if strings.Trim(text, " ") == "" {
+		return FieldMask{}, nil
+	}
+
+	expr, err := fieldMaskParser.ParseString("", text)
+	if err != nil {
+		return FieldMask{}, errors.WithMessagef(errors.WithStack(err), "syntax error")
+	}
+
+	result := FieldMask{paths: make([]maskPath, 0, len(expr.Paths))}
+	uniquePaths := make(map[string]struct{})
+	for _, p := range expr.Paths {
+		path := p.maskPath()
+		if len(expr.Paths) > 1 && len(path.segments) == 1 && path.wildcards[0] {
+			return FieldMask{}, errors.Errorf("the * field mask cannot be combined with other paths")
+		}
+		if _, ok := uniquePaths[path.String()]; ok {
+			return FieldMask{}, errors.Errorf("field appears multiple times: %q", path.String())
+		}
+		uniquePaths[path.String()] = struct{}{}
+		result.paths = append(result.paths, path)
+	}
+	return result, nil
+}
+
+// IsEmpty reports whether the field mask has no paths. AIP-157 and
+// AIP-134 treat an empty read or update mask specially (e.g. as the
+// default view or as the fields set in the request).
+func (m FieldMask) IsEmpty() bool {
+	return len(m.paths) == 0
+}
+
+// All reports whether the field mask is "*", selecting all fields.
+func (m FieldMask) All() bool {
+	return len(m.paths) == 1 && len(m.paths[0].segments) == 1 && m.paths[0].wildcards[0]
+}
+
+// String returns the canonical representation of the field mask,
+// following AIP-161 syntax.
+func (m FieldMask) String() string {
+	paths := make([]string, 0, len(m.paths))
+	for _, p := range m.paths {
+		paths = append(paths, p.String())
+	}
+	return strings.Join(paths, ",")
+}
+
+// String returns the canonical representation of the path.
+func (p maskPath) String() string {
+	segments := make([]string, 0, len(p.segments))
+	for i, segment := range p.segments {
+		if p.wildcards[i] {
+			segments = append(segments, "*")
+		} else {
+			segments = append(segments, NewFieldPath(segment).String())
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// matches reports whether the path selects the given column: the path
+// refers to the column, to a message containing it, to a key of a key
+// value column or to a value in a JSON column.
+func (p maskPath) matches(column *Column) bool {
+	segments := column.fieldPath.segments
+	if len(p.segments) > len(segments) && !column.json && !(column.keyValue && len(p.segments) == len(segments)+1) {
+		return false
+	}
+	for i := 0; i < len(p.segments) && i < len(segments); i++ {
+		if !p.wildcards[i] && p.segments[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type fieldMaskList struct {
+	Paths []*maskFieldPath `parser:"@@ ( Spaces? ',' @@ )* Spaces?"`
+}
+
+type maskFieldPath struct {
+	Segments []*maskSegment `parser:"Spaces? @@ ( '.' @@ )*"`
+}
+
+type maskSegment struct {
+	Wildcard bool     `parser:"@'*'"`
+	Segment  *segment `parser:"| @@"`
+}
+
+func (f *maskFieldPath) maskPath() maskPath {
+	result := maskPath{
+		segments:  make([]string, 0, len(f.Segments)),
+		wildcards: make([]bool, 0, len(f.Segments)),
+	}
+	for _, s := range f.Segments {
+		if s.Wildcard {
+			result.segments = append(result.segments, "*")
+		} else {
+			result.segments = append(result.segments, s.Segment.Value())
+		}
+		result.wildcards = append(result.wildcards, s.Wildcard)
+	}
+	return result
+}
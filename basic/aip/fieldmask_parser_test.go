@@ -0,0 +1,75 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseFieldMask(t *testing.T) {
+	Convey("ParseFieldMask", t, func() {
+		Convey("Values should be a comma separated list of field paths", func() {
+			result, err := ParseFieldMask("foo, bar.baz")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, FieldMask{paths: []maskPath{
+				{segments: []string{"foo"}, wildcards: []bool{false}},
+				{segments: []string{"bar", "baz"}, wildcards: []bool{false, false}},
+			}})
+			So(result.String(), ShouldEqual, "foo,bar.baz")
+			So(result.All(), ShouldBeFalse)
+			So(result.IsEmpty(), ShouldBeFalse)
+		})
+		Convey("Wildcards", func() {
+			result, err := ParseFieldMask("*")
+			So(err, ShouldBeNil)
+			So(result.All(), ShouldBeTrue)
+			So(result.String(), ShouldEqual, "*")
+
+			result, err = ParseFieldMask("labels.*,books.*.title")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, FieldMask{paths: []maskPath{
+				{segments: []string{"labels", "*"}, wildcards: []bool{false, true}},
+				{segments: []string{"books", "*", "title"}, wildcards: []bool{false, true, false}},
+			}})
+			So(result.All(), ShouldBeFalse)
+		})
+		Convey("Quoted strings can be used for map keys", func() {
+			result, err := ParseFieldMask("labels.`env-name`, labels.`*`")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, FieldMask{paths: []maskPath{
+				{segments: []string{"labels", "env-name"}, wildcards: []bool{false, false}},
+				{segments: []string{"labels", "*"}, wildcards: []bool{false, false}},
+			}})
+			So(result.String(), ShouldEqual, "labels.`env-name`,labels.`*`")
+		})
+		Convey("Empty field mask", func() {
+			result, err := ParseFieldMask("  ")
+			So(err, ShouldBeNil)
+			So(result.IsEmpty(), ShouldBeTrue)
+			So(result.All(), ShouldBeFalse)
+		})
+		Convey("Invalid input is rejected", func() {
+			_, err := ParseFieldMask("foo,")
+			So(err, ShouldErrLike, "syntax error")
+			_, err = ParseFieldMask("foo, *")
+			So(err, ShouldErrLike, "the * field mask cannot be combined with other paths")
+			_, err = ParseFieldMask("foo.bar, foo.`bar`")
+			So(err, ShouldErrLike, "field appears multiple times: \"foo.bar\"")
+		})
+	})
+}
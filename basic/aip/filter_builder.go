@@ -0,0 +1,212 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+// This file provides constructors to build filters programmatically, e.g.
+// to restrict a user supplied filter to the resources of a tenant:
+//
+//	filter, err := aip.ParseFilter(req.Filter)
+//	...
+//	filter = aip.And(filter, aip.Eq("tenant", tenant), aip.Not(aip.Eq("deleted", true)))
+//
+// The constructed filters are equivalent to parsed filters, and can be
+// used with Table.WhereClause, Table.Evaluator or Format. Invalid values,
+// e.g. nil, are recorded in the filter and returned by Filter.Err,
+// Table.WhereClause and Table.Evaluator.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Err returns the error recorded while building the filter, e.g. for a
+// value of an unsupported type, or nil.
+func (v *Filter) Err() error {
+	if v == nil {
+		return nil
+	}
+	return v.err
+}
+
+// And returns the conjunction of the filters. Empty filters, which match
+// everything, are ignored.
+func And(filters ...*Filter) *Filter {
+	e := &Expression{}
+	for _, f := range filters {
+		if err := f.Err(); err != nil {
+			return &Filter{err: err}
+		}
+		if f == nil || f.Expression == nil {
+			continue
+		}
+		e.Sequences = append(e.Sequences, f.Expression.Sequences...)
+	}
+	if len(e.Sequences) == 0 {
+		return &Filter{}
+	}
+	return &Filter{Expression: e}
+}
+
+// Or returns the disjunction of the filters. If any filter is empty, and
+// thus matches everything, the result is empty too.
+func Or(filters ...*Filter) *Filter {
+	factor := &Factor{}
+	for _, f := range filters {
+		if err := f.Err(); err != nil {
+			return &Filter{err: err}
+		}
+	}
+	for _, f := range filters {
+		if f == nil || f.Expression == nil {
+			return &Filter{}
+		}
+		if single := singleFactor(f.Expression); single != nil {
+			factor.Terms = append(factor.Terms, single.Terms...)
+		} else {
+			factor.Terms = append(factor.Terms, &Term{Simple: &Simple{Composite: f.Expression}})
+		}
+	}
+	if len(factor.Terms) == 0 {
+		return &Filter{}
+	}
+	return termFilter(factor.Terms...)
+}
+
+// Not returns the negation of the filter. The negation of an empty
+// filter, which cannot be expressed, is the empty filter.
+func Not(filter *Filter) *Filter {
+	if err := filter.Err(); err != nil {
+		return &Filter{err: err}
+	}
+	if filter == nil || filter.Expression == nil {
+		return &Filter{}
+	}
+	if f := singleFactor(filter.Expression); f != nil && len(f.Terms) == 1 && !f.Terms[0].Negated {
+		return termFilter(&Term{Negated: true, Simple: f.Terms[0].Simple})
+	}
+	return termFilter(&Term{Negated: true, Simple: &Simple{Composite: filter.Expression}})
+}
+
+// Eq returns a filter matching resources whose field equals the value,
+// e.g. Eq("author.name", "x") is equivalent to `author.name = "x"`.
+// The field is a field path with segments separated by '.', and the value
+// a string, bool, integer, float, time.Time or time.Duration. Other values,
+// including nil, and fields with segments which cannot be written as text,
+// e.g. "labels.two words", are recorded as the error of the filter.
+func Eq(field string, value any) *Filter {
+	return restrictionFilter(field, "=", value)
+}
+
+// Ne returns a filter matching resources whose field does not equal the
+// value. See Eq for the supported fields and values.
+func Ne(field string, value any) *Filter {
+	return restrictionFilter(field, "!=", value)
+}
+
+// Lt returns a filter matching resources whose field is less than the
+// value. See Eq for the supported fields and values.
+func Lt(field string, value any) *Filter {
+	return restrictionFilter(field, "<", value)
+}
+
+// Le returns a filter matching resources whose field is less than or
+// equal to the value. See Eq for the supported fields and values.
+func Le(field string, value any) *Filter {
+	return restrictionFilter(field, "<=", value)
+}
+
+// Gt returns a filter matching resources whose field is greater than the
+// value. See Eq for the supported fields and values.
+func Gt(field string, value any) *Filter {
+	return restrictionFilter(field, ">", value)
+}
+
+// Ge returns a filter matching resources whose field is greater than or
+// equal to the value. See Eq for the supported fields and values.
+func Ge(field string, value any) *Filter {
+	return restrictionFilter(field, ">=", value)
+}
+
+// Has returns a filter using the has (:) operator, e.g. Has("name", "x")
+// is equivalent to `name:"x"`. See Eq for the supported fields and values.
+func Has(field string, value any) *Filter {
+	return restrictionFilter(field, ":", value)
+}
+
+// restrictionFilter returns a filter with a single restriction on the field.
+func restrictionFilter(field, comparator string, value any) *Filter {
+	text, err := valueText(value)
+	if err != nil {
+		return &Filter{err: fmt.Errorf("invalid value of %s: %w", field, err)}
+	}
+	member := &Member{Value: field}
+	if i := strings.IndexByte(field, '.'); i >= 0 {
+		member = &Member{Value: field[:i], Fields: strings.Split(field[i+1:], ".")}
+		// The segments of a member with fields cannot be quoted.
+		for _, segment := range strings.Split(field, ".") {
+			if formatValue(segment) != segment {
+				return &Filter{err: fmt.Errorf("invalid field %q: segment %q cannot be written as text", field, segment)}
+			}
+		}
+	}
+	return termFilter(&Term{Simple: &Simple{Restriction: &Restriction{
+		Comparable: &Comparable{Member: member},
+		Comparator: comparator,
+		Arg:        &Arg{Comparable: &Comparable{Member: &Member{Value: text}}},
+	}}})
+}
+
+// valueText returns the literal text of a value, as parsed by literalValue.
+func valueText(value any) (string, error) {
+	v, ok := normalizeValue(value)
+	if !ok {
+		return "", fmt.Errorf("cannot use %#v as a filter value", value)
+	}
+	var columnType ColumnType
+	switch v.(type) {
+	case string:
+		columnType = ColumnTypeString
+	case bool:
+		columnType = ColumnTypeBool
+	case int64:
+		columnType = ColumnTypeInt64
+	case float64:
+		columnType = ColumnTypeFloat64
+	case time.Time:
+		columnType = ColumnTypeTimestamp
+	case time.Duration:
+		columnType = ColumnTypeDuration
+	case []byte:
+		return string(v.([]byte)), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+	return formatLiteral(columnType, v)
+}
+
+// singleFactor returns the factor of an expression made of a single
+// factor, or nil.
+func singleFactor(e *Expression) *Factor {
+	if len(e.Sequences) == 1 && len(e.Sequences[0].Factors) == 1 {
+		return e.Sequences[0].Factors[0]
+	}
+	return nil
+}
+
+// termFilter returns a filter with a single factor, the disjunction of the terms.
+func termFilter(terms ...*Term) *Filter {
+	return &Filter{Expression: &Expression{Sequences: []*Sequence{{Factors: []*Factor{{Terms: terms}}}}}}
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+)
+
+func TestFilterBuilder(t *testing.T) {
+	Convey("Filter builder", t, func() {
+		parse := func(filter string) *Filter {
+			f, err := ParseFilter(filter)
+			So(err, ShouldBeNil)
+			return f
+		}
+
+		Convey("Restrictions", func() {
+			So(Format(Eq("name", "x")), ShouldEqual, "name = x")
+			So(Format(Ne("author.name", "John Doe")), ShouldEqual, `author.name != "John Doe"`)
+			So(Format(Lt("pages", 100)), ShouldEqual, "pages < 100")
+			So(Format(Le("rating", 2.5)), ShouldEqual, `rating <= "2.5"`)
+			So(Format(Gt("create_time", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))), ShouldEqual, `create_time > "2024-01-02T03:04:05Z"`)
+			So(Format(Ge("ttl", 1500*time.Millisecond)), ShouldEqual, `ttl >= "1.500000000s"`)
+			So(Format(Has("labels.env", "prod")), ShouldEqual, "labels.env:prod")
+			So(Format(Eq("deleted", false)), ShouldEqual, "deleted = false")
+		})
+		Convey("Equivalent to parsed filters", func() {
+			So(Eq("name", "x"), ShouldResemble, parse("name = x"))
+			So(Has("labels.env", "prod"), ShouldResemble, parse("labels.env:prod"))
+			So(And(Eq("a", "1"), Eq("b", "2")), ShouldResemble, parse("a = 1 AND b = 2"))
+			So(Or(Eq("a", "1"), Eq("b", "2")), ShouldResemble, parse("a = 1 OR b = 2"))
+			So(Not(Eq("a", "1")), ShouldResemble, parse("NOT a = 1"))
+		})
+		Convey("And", func() {
+			user := parse("a OR b c")
+			So(Format(And(user, Eq("tenant", "t1"))), ShouldEqual, "a OR b c AND tenant = t1")
+			So(Format(And(&Filter{}, Eq("tenant", "t1"), nil)), ShouldEqual, "tenant = t1")
+			So(And(&Filter{}), ShouldResemble, &Filter{})
+		})
+		Convey("Or", func() {
+			So(Format(Or(parse("a OR b"), parse("c d"), Not(Eq("e", "f")))), ShouldEqual, "a OR b OR (c d) OR NOT e = f")
+			So(Or(Eq("a", "1"), &Filter{}), ShouldResemble, &Filter{})
+		})
+		Convey("Not", func() {
+			So(Format(Not(parse("a b"))), ShouldEqual, "NOT (a b)")
+			So(Format(Not(Not(Eq("a", "1")))), ShouldEqual, "NOT (NOT a = 1)")
+			So(Not(&Filter{}), ShouldResemble, &Filter{})
+			So(Not(nil), ShouldResemble, &Filter{})
+		})
+		Convey("Invalid values", func() {
+			So(Eq("a", nil).Err(), ShouldErrLike, "invalid value of a: cannot use <nil> as a filter value")
+			So(Eq("a", (*string)(nil)).Err(), ShouldErrLike, "cannot use (*string)(nil) as a filter value")
+			So(Eq("a", "1").Err(), ShouldBeNil)
+
+			invalid := Ge("a", nil)
+			So(And(Eq("b", "1"), invalid).Err(), ShouldEqual, invalid.Err())
+			So(Or(&Filter{}, invalid).Err(), ShouldEqual, invalid.Err())
+			So(Not(invalid).Err(), ShouldEqual, invalid.Err())
+
+			table := NewTable().WithColumns(
+				NewColumn().WithFieldPath("a").WithDatabaseName("db_a").Filterable().Build(),
+			).Build()
+			_, _, err := table.WhereClause(And(Eq("a", "1"), invalid), "p_")
+			So(err, ShouldErrLike, "invalid value of a")
+			_, err = table.Evaluator(invalid)
+			So(err, ShouldErrLike, "invalid value of a")
+		})
+		Convey("Field segments", func() {
+			So(Eq("labels.two words", "x").Err(), ShouldErrLike, `invalid field "labels.two words": segment "two words" cannot be written as text`)
+			So(Has("a.AND", "x").Err(), ShouldErrLike, `segment "AND" cannot be written as text`)
+			So(Has("a..b", "x").Err(), ShouldErrLike, `segment "" cannot be written as text`)
+			So(Has("-a.b", "x").Err(), ShouldErrLike, `segment "-a" cannot be written as text`)
+			// A single segment is written as a string.
+			filter := Eq("two words", "x")
+			So(Format(filter), ShouldEqual, `"two words" = x`)
+			So(parse(Format(filter)), ShouldResemble, filter)
+		})
+		Convey("Usable with WhereClause", func() {
+			table := NewTable().WithColumns(
+				NewColumn().WithFieldPath("name").WithDatabaseName("db_name").Filterable().Build(),
+				NewColumn().WithFieldPath("tenant").WithDatabaseName("db_tenant").Filterable().Build(),
+				NewColumn().WithFieldPath("deleted").WithDatabaseName("db_deleted").Bool().Filterable().Build(),
+				NewColumn().WithFieldPath("pages").WithDatabaseName("db_pages").Int64().Filterable().Build(),
+			).Build()
+			filter := And(parse("name:x OR pages > 10"), Eq("tenant", "t1"), Not(Eq("deleted", true)))
+			result, pars, err := table.WhereClause(filter, "p_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "(((db_name LIKE @p_0) OR (db_pages > @p_1)) AND (db_tenant = @p_2) AND (NOT (db_deleted = TRUE)))")
+			So(pars, ShouldResemble, []QueryParameter{
+				{Name: "p_0", Value: "%x%"},
+				{Name: "p_1", Value: int64(10)},
+				{Name: "p_2", Value: "t1"},
+			})
+		})
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+var (
+	// The kinds of token a term starts with.
+	termKinds = []string{kindNegate, kindText, kindString, kindLParen}
+	// The kinds of token a simple expression or an arg starts with.
+	simpleKinds = []string{kindText, kindString, kindLParen}
+)
+
+// FilterSyntaxError is returned by ParseFilter for filters which are not
+// valid AIP-160 syntax, e.g. `a AND` or `f(a`.
+//
+// Services should return it to the client as an INVALID_ARGUMENT error
+// with a BadRequest detail, e.g.:
+//
+//	var syntaxErr *aip.FilterSyntaxError
+//	if errors.As(err, &syntaxErr) {
+//		st, _ := status.New(codes.InvalidArgument, "invalid filter").WithDetails(&errdetails.BadRequest{
+//			FieldViolations: []*errdetails.BadRequest_FieldViolation{syntaxErr.FieldViolation()},
+//		})
+//		return nil, st.Err()
+//	}
+type FilterSyntaxError struct {
+	// Offset is the byte offset of the error in the filter, starting at 0.
+	Offset int
+	// Line and Column are the position of the error in the filter,
+	// starting at 1. Columns are counted in runes.
+	Line, Column int
+	// Expected are the kinds of token which were expected at the position
+	// of the error, e.g. "RPAREN", if any.
+	Expected []string
+	// Found is the text found at the position of the error, empty at the
+	// end of the filter.
+	Found string
+	// Message describes the error, e.g. `expected RPAREN, got END`.
+	Message string
+}
+
+// newFilterSyntaxError returns a syntax error at the given token.
+func newFilterSyntaxError(t *token, expected []string, message string) *FilterSyntaxError {
+	return &FilterSyntaxError{
+		Offset:   t.pos.offset,
+		Line:     t.pos.line,
+		Column:   t.pos.column,
+		Expected: expected,
+		Found:    t.value,
+		Message:  message,
+	}
+}
+
+// Error implements error.
+func (e *FilterSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// FieldViolation returns the error as a violation of the filter field of
+// a request, to be returned in a google.rpc.BadRequest error detail.
+func (e *FilterSyntaxError) FieldViolation() *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{
+		Field:       "filter",
+		Description: e.Error(),
+	}
+}
+
+// LimitExceededError is returned by ParseFilter, ParseFilterWithOptions
+// and ParseOrderByWithOptions for input exceeding one of their limits.
+type LimitExceededError struct {
+	// Field is the request field of the input, "filter" or "order_by".
+	Field string
+	// Limit is the name of the exceeded limit, e.g. "MaxDepth".
+	Limit string
+	// Max is the value of the exceeded limit.
+	Max int
+}
+
+// limitDescriptions describe the limits of Options and OrderByOptions.
+var limitDescriptions = map[string]string{
+	"MaxDepth":   "maximum nesting depth",
+	"MaxTerms":   "maximum number of terms",
+	"MaxLength":  "maximum length in bytes",
+	"MaxClauses": "maximum number of fields",
+}
+
+// Error implements error.
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s exceeds the %s of %d", e.Field, limitDescriptions[e.Limit], e.Max)
+}
+
+// FieldViolation returns the error as a violation of the field of a
+// request, to be returned in a google.rpc.BadRequest error detail.
+func (e *LimitExceededError) FieldViolation() *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{
+		Field:       e.Field,
+		Description: e.Error(),
+	}
+}
+
+// describeToken describes a token in error messages, e.g. `TEXT("a")`.
+func describeToken(t *token) string {
+	if t.kind == kindEnd {
+		return kindEnd
+	}
+	return fmt.Sprintf("%s(%q)", t.kind, t.value)
+}
@@ -0,0 +1,534 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// predicate reports whether a Go value matches (part of) a filter.
+type predicate func(v any) (truth, error)
+
+// truth is a truth value of the three-valued logic of SQL.
+type truth int8
+
+const (
+	isFalse truth = iota
+	isTrue
+	// isUnknown is the truth of restrictions on missing (NULL) values, and
+	// of their negations.
+	isUnknown
+)
+
+// truthOf returns the truth value of b.
+func truthOf(b bool) truth {
+	if b {
+		return isTrue
+	}
+	return isFalse
+}
+
+// not returns the negation of t, which is unknown if t is unknown.
+func (t truth) not() truth {
+	switch t {
+	case isTrue:
+		return isFalse
+	case isFalse:
+		return isTrue
+	}
+	return isUnknown
+}
+
+// Evaluator returns a function reporting whether a Go value matches the
+// given filter, with the same semantics as WhereClause. This allows the
+// filter of a List request to be applied to cached or aggregated
+// resources, or to the resources of a watch stream.
+//
+// Values may be structs, maps with string keys or proto messages, or
+// pointers to them. Columns are looked up by their field path, not their
+// database name; see field_value.go for how field paths are resolved.
+//
+// Unlike SQL, substring matching with the has (:) operator is always
+// case-sensitive. Missing fields (e.g. nil pointers or unset message
+// fields) are evaluated as NULL values in SQL: a restriction on a missing
+// field is unknown, so that neither the restriction nor its negation
+// matches. Missing boolean fields are treated as false, and missing key
+// value and repeated fields as empty, so that e.g. `-labels.env = "prod"`
+// matches values without the key. Filters using functions are rejected.
+//
+// Errors about the filter itself are returned immediately, the returned
+// function only fails if a field has a Go type incompatible with the
+// column type.
+func (t *Table) Evaluator(filter *Filter) (func(v any) (bool, error), error) {
+	if err := filter.Err(); err != nil {
+		return nil, err
+	}
+	if filter.Expression == nil {
+		return func(any) (bool, error) { return true, nil }, nil
+	}
+	e := &evaluator{table: t}
+	p, err := e.expression(filter.Expression)
+	if err != nil {
+		return nil, err
+	}
+	return func(v any) (bool, error) {
+		t, err := p(v)
+		return t == isTrue, err
+	}, nil
+}
+
+// evaluator compiles parsed AIP-160 filters into predicates.
+type evaluator struct {
+	table *Table
+}
+
+func (e *evaluator) expression(expression *Expression) (predicate, error) {
+	var factors []predicate
+	for _, sequence := range expression.Sequences {
+		for _, factor := range sequence.Factors {
+			f, err := e.factor(factor)
+			if err != nil {
+				return nil, err
+			}
+			factors = append(factors, f)
+		}
+	}
+	return func(v any) (truth, error) {
+		result := isTrue
+		for _, f := range factors {
+			t, err := f(v)
+			if err != nil || t == isFalse {
+				return isFalse, err
+			}
+			if t == isUnknown {
+				result = isUnknown
+			}
+		}
+		return result, nil
+	}, nil
+}
+
+func (e *evaluator) factor(factor *Factor) (predicate, error) {
+	var terms []predicate
+	for _, term := range factor.Terms {
+		t, err := e.term(term)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+	return func(v any) (truth, error) {
+		result := isFalse
+		for _, term := range terms {
+			t, err := term(v)
+			if err != nil || t == isTrue {
+				return t, err
+			}
+			if t == isUnknown {
+				result = isUnknown
+			}
+		}
+		return result, nil
+	}, nil
+}
+
+func (e *evaluator) term(term *Term) (predicate, error) {
+	simple, err := e.simple(term.Simple)
+	if err != nil {
+		return nil, err
+	}
+	if !term.Negated {
+		return simple, nil
+	}
+	return func(v any) (truth, error) {
+		t, err := simple(v)
+		return t.not(), err
+	}, nil
+}
+
+func (e *evaluator) simple(simple *Simple) (predicate, error) {
+	if simple.Restriction != nil {
+		return e.restriction(simple.Restriction)
+	} else if simple.Composite != nil {
+		return e.expression(simple.Composite)
+	}
+	return nil, fmt.Errorf("invalid 'simple' clause in query filter")
+}
+
+func (e *evaluator) restriction(restriction *Restriction) (predicate, error) {
+	if restriction.Comparable.Function != nil {
+		return nil, fmt.Errorf("function %s cannot be evaluated in memory", restriction.Comparable.Function.QualifiedName)
+	}
+	if restriction.Comparable.Member == nil {
+		return nil, fmt.Errorf("invalid comparable")
+	}
+	if restriction.Comparator == "" {
+		if len(restriction.Comparable.Member.Fields) > 0 {
+			value := restriction.Comparable.Member.Value
+			fields := strings.Join(restriction.Comparable.Member.Fields, ".")
+			return nil, fmt.Errorf("fields are not allowed without an operator, try wrapping %s.%s in double quotes: \"%s.%s\"", value, fields, value, fields)
+		}
+		text, err := likeComparableText(restriction.Comparable)
+		if err != nil {
+			return nil, err
+		}
+		var columns []*Column
+		for _, column := range e.table.columns {
+			if column.implicitFilter {
+				columns = append(columns, column)
+			}
+		}
+		return func(v any) (truth, error) {
+			result := isFalse
+			for _, column := range columns {
+				t, err := containsPredicate(column, column.fieldPath.segments, text)(v)
+				if err != nil || t == isTrue {
+					return t, err
+				}
+				if t == isUnknown {
+					result = isUnknown
+				}
+			}
+			return result, nil
+		}, nil
+	}
+	column, fields, err := e.table.filterableColumnByMember(restriction.Comparable.Member)
+	if err != nil {
+		return nil, err
+	}
+	if column.keyValue && isOrderingComparator(restriction.Comparator) {
+		return nil, fmt.Errorf("ordering comparator %q cannot be used on key value column %q", restriction.Comparator, column.fieldPath.String())
+	}
+	if column.json {
+		return e.jsonRestriction(restriction, column, fields)
+	}
+	if len(fields) > 0 {
+		if !column.keyValue {
+			return nil, fmt.Errorf("fields are only supported for key value columns.  Try removing the '.' from after your column named %q", column.fieldPath.String())
+		}
+		if len(fields) > 1 {
+			return nil, fmt.Errorf("expected only a single '.' in keyvalue column named %q", column.fieldPath.String())
+		}
+		return e.keyValueRestriction(restriction, column, fields[0])
+	} else if column.keyValue {
+		if restriction.Comparator == ":" {
+			key, err := hasKeyText(restriction.Arg)
+			if err != nil {
+				return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+			}
+			return hasKeyPredicate(column, key), nil
+		}
+		// nolint: lll
+		return nil, fmt.Errorf("key value columns must specify the key to search on.  Instead of '%s%s' try '%s.key%s'", column.fieldPath.String(), restriction.Comparator, column.fieldPath.String(), restriction.Comparator)
+	} else if column.repeated {
+		if err := checkRepeatedComparator(restriction.Comparator, column); err != nil {
+			return nil, err
+		}
+		comparable, err := elementComparable(restriction.Arg)
+		if err != nil {
+			return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		value, err := literalValue(comparable, column)
+		if err != nil {
+			return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		return elementPredicate(column, value), nil
+	}
+	return e.valueRestriction(restriction, column, column.fieldPath.segments)
+}
+
+// jsonRestriction returns a predicate for a restriction on the value at
+// the given fields of a JSON column.
+func (e *evaluator) jsonRestriction(restriction *Restriction, column *Column, fields []string) (predicate, error) {
+	if len(column.jsonPath)+len(fields) == 0 {
+		// nolint: lll
+		return nil, fmt.Errorf("JSON columns must specify the field to search on.  Instead of '%s%s' try '%s.field%s'", column.fieldPath.String(), restriction.Comparator, column.fieldPath.String(), restriction.Comparator)
+	}
+	segments := append(slices.Clone(column.fieldPath.segments), fields...)
+	if restriction.Comparator == ":" && isWildcardArg(restriction.Arg) {
+		return func(v any) (truth, error) {
+			_, ok := fieldValue(v, segments)
+			return truthOf(ok), nil
+		}, nil
+	}
+	return e.valueRestriction(restriction, column, segments)
+}
+
+// valueRestriction returns a predicate for a restriction on the scalar
+// value of the column at the given path segments.
+func (e *evaluator) valueRestriction(restriction *Restriction, column *Column, segments []string) (predicate, error) {
+	if restriction.Comparator == ":" {
+		text, err := likeArgText(restriction.Arg, column)
+		if err != nil {
+			return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		return containsPredicate(column, segments, text), nil
+	}
+	if isOrderingComparator(restriction.Comparator) {
+		if column.columnType == ColumnTypeBool {
+			return nil, fmt.Errorf("ordering comparator %q cannot be used on boolean field %q", restriction.Comparator, column.fieldPath.String())
+		}
+		if column.argSubstitute != nil {
+			return nil, fmt.Errorf("cannot use ordering comparator %q on a field that have argSubstitute function", restriction.Comparator)
+		}
+	} else if restriction.Comparator != "=" && restriction.Comparator != "!=" {
+		return nil, fmt.Errorf("comparator operator not implemented yet")
+	} else {
+		text, ok, err := wildcardText(restriction.Arg, column)
+		if err != nil {
+			return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		if ok {
+			return wildcardPredicate(column, segments, text, restriction.Comparator == "="), nil
+		}
+	}
+	arg, err := e.argValue(restriction.Arg, column)
+	if err != nil {
+		return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+	}
+	comparator := restriction.Comparator
+	return func(v any) (truth, error) {
+		value, ok := fieldValue(v, segments)
+		switch {
+		case !ok && (column.columnType != ColumnTypeBool || column.json):
+			return isUnknown, nil
+		case !ok:
+			// NULL values are mapped to FALSE.
+			value = false
+		case column.json:
+			value = jsonColumnValue(column, value)
+		}
+		c, err := compareColumnValue(column, value, arg)
+		if err != nil {
+			return isFalse, err
+		}
+		return truthOf(compareResult(comparator, c)), nil
+	}, nil
+}
+
+// keyValueRestriction returns a predicate for a restriction on the
+// given key of a key value column.
+func (e *evaluator) keyValueRestriction(restriction *Restriction, column *Column, key string) (predicate, error) {
+	var match func(value string) bool
+	switch restriction.Comparator {
+	case ":":
+		if isWildcardArg(restriction.Arg) {
+			return hasKeyPredicate(column, key), nil
+		}
+		text, err := likeArgText(restriction.Arg, column)
+		if err != nil {
+			return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		match = func(value string) bool { return strings.Contains(value, text) }
+	case "=", "!=":
+		arg, err := e.argValue(restriction.Arg, column)
+		if err != nil {
+			return nil, errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		text := fmt.Sprint(arg)
+		equal := restriction.Comparator == "="
+		match = func(value string) bool { return (value == text) == equal }
+	default:
+		return nil, fmt.Errorf("comparator operator not implemented for fields yet")
+	}
+	return func(v any) (truth, error) {
+		value, ok, err := keyValueLookup(v, column, key)
+		if err != nil || !ok {
+			return isFalse, err
+		}
+		return truthOf(match(value)), nil
+	}, nil
+}
+
+// argValue returns the Go value of the specified arg.
+func (e *evaluator) argValue(arg *Arg, column *Column) (any, error) {
+	if arg.Composite != nil {
+		return nil, fmt.Errorf("composite expressions in arguments not implemented yet")
+	}
+	if arg.Comparable == nil {
+		return nil, fmt.Errorf("missing comparable in argument")
+	}
+	if arg.Comparable.Function != nil {
+		return nil, fmt.Errorf("function %s cannot be evaluated in memory", arg.Comparable.Function.QualifiedName)
+	}
+	return literalValue(arg.Comparable, column)
+}
+
+// containsPredicate returns a predicate matching values whose string column,
+// at the given path segments, contains the given text.
+func containsPredicate(column *Column, segments []string, text string) predicate {
+	return func(v any) (truth, error) {
+		value, ok := fieldValue(v, segments)
+		if !ok {
+			return isUnknown, nil
+		}
+		s, err := columnString(column, value)
+		if err != nil {
+			return isFalse, err
+		}
+		return truthOf(strings.Contains(s, text)), nil
+	}
+}
+
+// elementPredicate returns a predicate matching values whose repeated
+// column contains an element equal to the given literal.
+func elementPredicate(column *Column, literal any) predicate {
+	return func(v any) (truth, error) {
+		elements, ok := fieldValue(v, column.fieldPath.segments)
+		if !ok {
+			return isFalse, nil
+		}
+		rv := reflect.ValueOf(elements)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return isFalse, fmt.Errorf("field %s: expected a repeated value but got %T", column.fieldPath.String(), elements)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			element, ok := normalizeValue(rv.Index(i).Interface())
+			if !ok {
+				continue
+			}
+			c, err := compareColumnValue(column, element, literal)
+			if err != nil {
+				return isFalse, err
+			}
+			if c == 0 {
+				return isTrue, nil
+			}
+		}
+		return isFalse, nil
+	}
+}
+
+// wildcardPredicate returns a predicate matching values whose string
+// column, at the given path segments, matches the text with * wildcards,
+// or does not match it if equal is false.
+func wildcardPredicate(column *Column, segments []string, text string, equal bool) predicate {
+	return func(v any) (truth, error) {
+		value, ok := fieldValue(v, segments)
+		if !ok {
+			return isUnknown, nil
+		}
+		s, err := columnString(column, value)
+		if err != nil {
+			return isFalse, err
+		}
+		return truthOf(wildcardMatch(text, s) == equal), nil
+	}
+}
+
+// jsonColumnValue converts a value of a JSON column to the Go type of the
+// column where JSON has no equivalent type: timestamps are RFC 3339
+// strings.
+func jsonColumnValue(column *Column, value any) any {
+	if s, ok := value.(string); ok && column.columnType == ColumnTypeTimestamp {
+		if t, err := parseLiteral(ColumnTypeTimestamp, s); err == nil {
+			return t
+		}
+	}
+	return value
+}
+
+// hasKeyPredicate returns a predicate matching values whose key value
+// column contains the given key.
+func hasKeyPredicate(column *Column, key string) predicate {
+	return func(v any) (truth, error) {
+		_, ok, err := keyValueLookup(v, column, key)
+		return truthOf(ok), err
+	}
+}
+
+// keyValueLookup returns the value of the key in the key value column of v.
+// The column may hold a map with string keys or a slice of structs (or
+// messages) with key and value fields.
+func keyValueLookup(v any, column *Column, key string) (string, bool, error) {
+	entries, ok := fieldValue(v, column.fieldPath.segments)
+	if !ok {
+		return "", false, nil
+	}
+	rv := reflect.ValueOf(entries)
+	switch rv.Kind() {
+	case reflect.Map:
+		value, ok := fieldValue(entries, []string{key})
+		if !ok {
+			return "", false, nil
+		}
+		return fmt.Sprint(value), true, nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			entry := rv.Index(i).Interface()
+			if k, ok := fieldValue(entry, []string{"key"}); ok && fmt.Sprint(k) == key {
+				value, ok := fieldValue(entry, []string{"value"})
+				if !ok {
+					return "", false, nil
+				}
+				return fmt.Sprint(value), true, nil
+			}
+		}
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("field %s: expected a map or a list of key value entries but got %T", column.fieldPath.String(), entries)
+}
+
+// columnString returns the normalized value of a string column.
+func columnString(column *Column, value any) (string, error) {
+	switch x := value.(type) {
+	case string:
+		return x, nil
+	case []byte:
+		return string(x), nil
+	}
+	return "", fmt.Errorf("field %s: expected a string but got %T", column.fieldPath.String(), value)
+}
+
+// compareColumnValue compares the normalized value of a column with a
+// literal returned by literalValue, returning -1, 0 or +1.
+func compareColumnValue(column *Column, value, literal any) (int, error) {
+	if _, ok := literal.(string); ok {
+		s, err := columnString(column, value)
+		if err != nil {
+			return 0, err
+		}
+		value = s
+	}
+	c, ok := compareValues(value, literal)
+	if !ok {
+		return 0, fmt.Errorf("field %s: expected a value of type %s but got %T", column.fieldPath.String(), column.columnType.String(), value)
+	}
+	return c, nil
+}
+
+// compareResult returns whether the result of a comparison satisfies the comparator.
+func compareResult(comparator string, c int) bool {
+	switch comparator {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type evaluatorTestLabel struct {
+	Key   string
+	Value string
+}
+
+type evaluatorTestItem struct {
+	Foo      string
+	Bar      *string
+	Baz      sql.NullString    `json:"bazz"`
+	KV       map[string]string `aip:"path=kv"`
+	Labels   []evaluatorTestLabel
+	Tags     []string
+	Scores   []int32
+	Spec     json.RawMessage
+	Host     string
+	Bool     bool
+	Int      int32
+	Float    float64
+	Time     time.Time
+	Duration time.Duration
+}
+
+func TestEvaluator(t *testing.T) {
+	Convey("Evaluator", t, func() {
+		table := NewTable().WithColumns(
+			NewColumn().WithFieldPath("foo").WithDatabaseName("db_foo").FilterableImplicitly().Build(),
+			NewColumn().WithFieldPath("bar").WithDatabaseName("db_bar").FilterableImplicitly().Build(),
+			NewColumn().WithFieldPath("bazz").WithDatabaseName("db_baz").Filterable().Build(),
+			NewColumn().WithFieldPath("kv").WithDatabaseName("db_kv").KeyValue().Filterable().Build(),
+			NewColumn().WithFieldPath("labels").WithDatabaseName("db_labels").KeyValue().Filterable().Build(),
+			NewColumn().WithFieldPath("tags").WithDatabaseName("db_tags").Repeated().Filterable().Build(),
+			NewColumn().WithFieldPath("scores").WithDatabaseName("db_scores").Int64().Repeated().Filterable().Build(),
+			NewColumn().WithFieldPath("spec").WithDatabaseName("db_spec").JSON().Filterable().Build(),
+			NewColumn().WithFieldPath("spec", "replicas").WithDatabaseName("db_spec").JSON("replicas").Int64().Filterable().Build(),
+			NewColumn().WithFieldPath("spec", "create_time").WithDatabaseName("db_spec").JSON("create_time").Timestamp().Filterable().Build(),
+			NewColumn().WithFieldPath("host").WithDatabaseName("db_host").WithWildcards().Filterable().Build(),
+			NewColumn().WithFieldPath("bool").WithDatabaseName("db_bool").Bool().Filterable().Build(),
+			NewColumn().WithFieldPath("int").WithDatabaseName("db_int").Int64().Filterable().Build(),
+			NewColumn().WithFieldPath("float").WithDatabaseName("db_float").Float64().Filterable().Build(),
+			NewColumn().WithFieldPath("time").WithDatabaseName("db_time").Timestamp().Filterable().Build(),
+			NewColumn().WithFieldPath("duration").WithDatabaseName("db_duration").Duration().Filterable().Build(),
+			NewColumn().WithFieldPath("unfilterable").WithDatabaseName("unfilterable").Build(),
+		).Build()
+
+		bar := "barvalue"
+		item := &evaluatorTestItem{
+			Foo:      "somevalue",
+			Bar:      &bar,
+			Baz:      sql.NullString{String: "bazvalue", Valid: true},
+			KV:       map[string]string{"key": "value"},
+			Labels:   []evaluatorTestLabel{{Key: "env", Value: "prod"}},
+			Tags:     []string{"urgent", "bug"},
+			Scores:   []int32{7, 42},
+			Host:     "api.example.com",
+			Spec:     json.RawMessage(`{"owner": {"team": "infra"}, "replicas": 3, "create_time": "2024-01-02T03:04:05Z"}`),
+			Bool:     true,
+			Int:      42,
+			Float:    2.5,
+			Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Duration: 90 * time.Second,
+		}
+		eval := func(filter string, v any) (bool, error) {
+			f, err := ParseFilter(filter)
+			So(err, ShouldBeNil)
+			match, err := table.Evaluator(f)
+			if err != nil {
+				return false, err
+			}
+			return match(v)
+		}
+		matches := func(filter string, v any) bool {
+			ok, err := eval(filter, v)
+			So(err, ShouldBeNil)
+			return ok
+		}
+
+		Convey("Empty filter", func() {
+			match, err := table.Evaluator(&Filter{})
+			So(err, ShouldBeNil)
+			ok, err := match(item)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("Restrictions", func() {
+			So(matches("foo = somevalue", item), ShouldBeTrue)
+			So(matches("foo != somevalue", item), ShouldBeFalse)
+			So(matches("foo:value", item), ShouldBeTrue)
+			So(matches("foo:VALUE", item), ShouldBeFalse)
+			So(matches("bar = barvalue", item), ShouldBeTrue)
+			So(matches("bazz = bazvalue", item), ShouldBeTrue)
+			So(matches(`foo > "a"`, item), ShouldBeTrue)
+		})
+		Convey("Implicit filter", func() {
+			So(matches("barval", item), ShouldBeTrue)
+			So(matches("someval", item), ShouldBeTrue)
+			So(matches("bazval", item), ShouldBeFalse)
+		})
+		Convey("Key value columns", func() {
+			So(matches("kv.key = value", item), ShouldBeTrue)
+			So(matches("kv.key != value", item), ShouldBeFalse)
+			So(matches("kv.key:val", item), ShouldBeTrue)
+			So(matches("kv.other = value", item), ShouldBeFalse)
+			So(matches("labels.env = prod", item), ShouldBeTrue)
+			So(matches("labels.env:dev", item), ShouldBeFalse)
+		})
+		Convey("Key presence", func() {
+			So(matches("kv:key", item), ShouldBeTrue)
+			So(matches("kv:other", item), ShouldBeFalse)
+			So(matches("kv.key:*", item), ShouldBeTrue)
+			So(matches("kv.other:*", item), ShouldBeFalse)
+			So(matches("labels:env", item), ShouldBeTrue)
+			So(matches("labels.lang:*", item), ShouldBeFalse)
+		})
+		Convey("Repeated columns", func() {
+			So(matches("tags:bug", item), ShouldBeTrue)
+			So(matches("tags:bu", item), ShouldBeFalse)
+			So(matches("scores:42", item), ShouldBeTrue)
+			So(matches("scores:4", item), ShouldBeFalse)
+			So(matches("tags:bug", &evaluatorTestItem{}), ShouldBeFalse)
+			So(matches("scores:42", map[string]any{"scores": []any{int64(42)}}), ShouldBeTrue)
+		})
+		Convey("JSON columns", func() {
+			So(matches(`spec.owner.team = "infra"`, item), ShouldBeTrue)
+			So(matches("spec.owner.team:fra", item), ShouldBeTrue)
+			So(matches("spec.replicas > 2", item), ShouldBeTrue)
+			So(matches("spec.replicas = 2", item), ShouldBeFalse)
+			So(matches(`spec.create_time < "2025-01-01T00:00:00Z"`, item), ShouldBeTrue)
+			So(matches("spec.owner:*", item), ShouldBeTrue)
+			So(matches("spec.other:*", item), ShouldBeFalse)
+			So(matches("spec.other = x", item), ShouldBeFalse)
+			So(matches("spec.replicas > 2", map[string]any{"spec": map[string]any{"replicas": 3}}), ShouldBeTrue)
+		})
+		Convey("Wildcards", func() {
+			So(matches(`host = "*.example.com"`, item), ShouldBeTrue)
+			So(matches(`host = "api.*"`, item), ShouldBeTrue)
+			So(matches(`host = "*.*.com"`, item), ShouldBeTrue)
+			So(matches(`host = "a*i.*com"`, item), ShouldBeTrue)
+			So(matches(`host = "*.org"`, item), ShouldBeFalse)
+			So(matches(`host = "api.example.com*x"`, item), ShouldBeFalse)
+			So(matches(`host != "*.example.com"`, item), ShouldBeFalse)
+			So(matches(`host = "*.example.com"`, &evaluatorTestItem{}), ShouldBeFalse)
+		})
+		Convey("Typed columns", func() {
+			So(matches("bool = true", item), ShouldBeTrue)
+			So(matches("bool = false", item), ShouldBeFalse)
+			So(matches("int > 40 AND int <= 42", item), ShouldBeTrue)
+			So(matches("int = 43", item), ShouldBeFalse)
+			So(matches("float < 2.6", item), ShouldBeTrue)
+			So(matches(`time >= "2024-01-02T03:04:05Z"`, item), ShouldBeTrue)
+			So(matches(`time < "2024-01-02T03:04:05Z"`, item), ShouldBeFalse)
+			So(matches("duration = 90s", item), ShouldBeTrue)
+			So(matches("duration > 100.5s", item), ShouldBeFalse)
+		})
+		Convey("Logical operators", func() {
+			So(matches("foo = somevalue AND bar = other", item), ShouldBeFalse)
+			So(matches("foo = somevalue AND (bar = other OR int = 42)", item), ShouldBeTrue)
+			So(matches("NOT foo = somevalue", item), ShouldBeFalse)
+			So(matches("-int = 1", item), ShouldBeTrue)
+		})
+		Convey("Missing values", func() {
+			empty := &evaluatorTestItem{}
+			So(matches("bar = barvalue", empty), ShouldBeFalse)
+			So(matches("bazz = bazvalue", empty), ShouldBeFalse)
+			So(matches("bool = false", map[string]any{}), ShouldBeTrue)
+			So(matches("kv.key = value", empty), ShouldBeFalse)
+		})
+		Convey("Negated restrictions on missing values", func() {
+			empty := &evaluatorTestItem{}
+			// As with NULL values in SQL, neither the restriction nor its negation matches.
+			So(matches("NOT bar = barvalue", empty), ShouldBeFalse)
+			So(matches("-bar:value", empty), ShouldBeFalse)
+			So(matches("NOT int > 5", map[string]any{}), ShouldBeFalse)
+			So(matches("-spec.other = x", item), ShouldBeFalse)
+			So(matches(`NOT host = "*.com"`, map[string]any{}), ShouldBeFalse)
+			So(matches("NOT (bar = barvalue OR foo = other)", empty), ShouldBeFalse)
+			So(matches("NOT (bar = barvalue AND foo = other)", empty), ShouldBeTrue)
+			So(matches("-bar = barvalue OR foo = \"\"", empty), ShouldBeTrue)
+			// Key value and repeated fields without the key or element are empty.
+			So(matches(`-labels.env = "prod"`, empty), ShouldBeTrue)
+			So(matches(`-labels.env = "dev"`, item), ShouldBeTrue)
+			So(matches(`-labels.env = "prod"`, item), ShouldBeFalse)
+			So(matches("-kv:key", empty), ShouldBeTrue)
+			So(matches("-tags:bug", empty), ShouldBeTrue)
+		})
+		Convey("Maps", func() {
+			m := map[string]any{
+				"foo": "somevalue",
+				"int": 7,
+				"kv":  map[string]string{"key": "value"},
+			}
+			So(matches("foo = somevalue AND int < 10 AND kv.key = value", m), ShouldBeTrue)
+			So(matches("int >= 10", m), ShouldBeFalse)
+		})
+		Convey("Proto messages", func() {
+			md := testBookDescriptor()
+			table, err := TableFromMessage(md, nil)
+			So(err, ShouldBeNil)
+			book := dynamicpb.NewMessage(md)
+			set := func(name string, v protoreflect.Value) {
+				book.Set(md.Fields().ByName(protoreflect.Name(name)), v)
+			}
+			set("display_name", protoreflect.ValueOfString("The Go Programming Language"))
+			set("pages", protoreflect.ValueOfInt32(380))
+			set("state", protoreflect.ValueOfEnum(2))
+			set("create_time", protoreflect.ValueOfMessage(timestamppb.New(time.Date(2015, 10, 26, 0, 0, 0, 0, time.UTC)).ProtoReflect()))
+			set("edition", protoreflect.ValueOfMessage(wrapperspb.Int64(1).ProtoReflect()))
+			labels := book.Mutable(md.Fields().ByName("labels")).Map()
+			labels.Set(protoreflect.ValueOfString("lang").MapKey(), protoreflect.ValueOfString("go"))
+			author := dynamicpb.NewMessage(md.Messages().ByName("Author"))
+			author.Set(author.Descriptor().Fields().ByName("display_name"), protoreflect.ValueOfString("Donovan"))
+			set("author", protoreflect.ValueOfMessage(author))
+
+			evalBook := func(filter string) bool {
+				f, err := ParseFilter(filter)
+				So(err, ShouldBeNil)
+				match, err := table.Evaluator(f)
+				So(err, ShouldBeNil)
+				ok, err := match(book)
+				So(err, ShouldBeNil)
+				return ok
+			}
+			So(evalBook(`display_name:"Go" AND pages > 300`), ShouldBeTrue)
+			So(evalBook("state = PUBLISHED"), ShouldBeTrue)
+			So(evalBook(`create_time < "2016-01-01T00:00:00Z"`), ShouldBeTrue)
+			So(evalBook("edition = 1"), ShouldBeTrue)
+			So(evalBook("labels.lang = go"), ShouldBeTrue)
+			So(evalBook("author.display_name = Donovan"), ShouldBeTrue)
+			So(evalBook("published = true"), ShouldBeFalse)
+			So(evalBook("tags:go"), ShouldBeFalse)
+		})
+		Convey("Invalid filters", func() {
+			_, err := eval("unfilterable = x", item)
+			So(err, ShouldErrLike, "no filterable field \"unfilterable\"")
+			_, err = eval("kv = x", item)
+			So(err, ShouldErrLike, "key value columns must specify the key to search on")
+			_, err = eval("kv.key > x", item)
+			So(err, ShouldErrLike, "ordering comparator \">\" cannot be used on key value column \"kv\"")
+			_, err = eval("scores >= 7", item)
+			So(err, ShouldErrLike, "ordering comparator \">=\" cannot be used on repeated field \"scores\"")
+			_, err = eval("spec = x", item)
+			So(err, ShouldErrLike, "JSON columns must specify the field to search on")
+			_, err = eval("bool > true", item)
+			So(err, ShouldErrLike, "ordering comparator \">\" cannot be used on boolean field \"bool\"")
+			_, err = eval("int = abc", item)
+			So(err, ShouldErrLike, "argument for field int")
+			_, err = eval("startsWith(foo, \"x\")", item)
+			So(err, ShouldErrLike, "function startsWith cannot be evaluated in memory")
+		})
+		Convey("Type mismatches", func() {
+			_, err := eval("int = 1", map[string]any{"int": "one"})
+			So(err, ShouldErrLike, "field int: expected a value of type INT64 but got string")
+			_, err = eval("foo:x", map[string]any{"foo": 1})
+			So(err, ShouldErrLike, "field foo: expected a string but got int64")
+			_, err = eval("tags:x", map[string]any{"tags": "x"})
+			So(err, ShouldErrLike, "field tags: expected a repeated value but got string")
+		})
+	})
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format renders a filter as normalized AIP-160 text, which ParseFilter
+// parses back to an equivalent filter. An empty filter yields "".
+//
+// The output is normalized so that equivalent filters are likely to be
+// rendered identically:
+//   - sequences, conjunctions and disjunctions are separated by single
+//     spaces, " AND " and " OR ", and negations use "NOT ".
+//   - comparators are surrounded by spaces, except the has operator (:).
+//   - values are quoted only if they cannot be written as text, e.g.
+//     "hello world", "-30" or "AND".
+//   - parentheses are only kept where they are needed, e.g. "(a)" becomes
+//     "a" and "a AND (b c)" becomes "a AND b c". Nested conjunctions and
+//     disjunctions are flattened, as AND and OR are associative.
+func Format(filter *Filter) string {
+	if filter == nil || filter.Expression == nil {
+		return ""
+	}
+	var f formatter
+	f.expression(filter.Expression)
+	return f.String()
+}
+
+// formatter renders filter ASTs as AIP-160 text.
+type formatter struct {
+	strings.Builder
+}
+
+func (f *formatter) expression(e *Expression) {
+	for i, sequence := range e.Sequences {
+		if i > 0 {
+			f.WriteString(" AND ")
+		}
+		f.sequence(sequence)
+	}
+}
+
+func (f *formatter) sequence(s *Sequence) {
+	for i, factor := range s.Factors {
+		if i > 0 {
+			f.WriteString(" ")
+		}
+		f.factor(factor)
+	}
+}
+
+func (f *formatter) factor(factor *Factor) {
+	for i, term := range factor.Terms {
+		if i > 0 {
+			f.WriteString(" OR ")
+		}
+		f.term(term, len(factor.Terms) == 1)
+	}
+}
+
+// term renders a term. alone reports whether the term is the only term of
+// its factor.
+func (f *formatter) term(t *Term, alone bool) {
+	if t.Negated {
+		f.WriteString("NOT ")
+	}
+	f.simple(t.Simple, t.Negated, alone)
+}
+
+// simple renders a simple expression. negated reports whether it is
+// negated, alone whether it is the only term of its factor, in which case
+// a composite conjunction may be inlined.
+func (f *formatter) simple(s *Simple, negated, alone bool) {
+	if s.Restriction != nil {
+		f.restriction(s.Restriction)
+		return
+	}
+	e := s.Composite
+	switch {
+	case len(e.Sequences) == 1 && len(e.Sequences[0].Factors) == 1 && len(e.Sequences[0].Factors[0].Terms) == 1:
+		// A single term, e.g. (a) or NOT (a = b).
+		inner := e.Sequences[0].Factors[0].Terms[0]
+		if !(negated && inner.Negated) {
+			if inner.Negated {
+				f.WriteString("NOT ")
+			}
+			f.simple(inner.Simple, negated || inner.Negated, alone)
+			return
+		}
+	case len(e.Sequences) == 1 && len(e.Sequences[0].Factors) == 1 && !negated:
+		// A disjunction, e.g. (a OR b), which binds tighter than sequences
+		// and conjunctions and may be merged into the enclosing disjunction.
+		f.factor(e.Sequences[0].Factors[0])
+		return
+	case alone && !negated:
+		// A conjunction, e.g. (a b) or (a AND b), merged into the enclosing
+		// conjunction.
+		f.expression(e)
+		return
+	}
+	f.WriteString("(")
+	f.expression(e)
+	f.WriteString(")")
+}
+
+func (f *formatter) restriction(r *Restriction) {
+	f.comparable(r.Comparable)
+	if r.Comparator == "" {
+		return
+	}
+	if r.Comparator == ":" {
+		f.WriteString(":")
+	} else {
+		f.WriteString(" " + r.Comparator + " ")
+	}
+	f.arg(r.Arg)
+}
+
+func (f *formatter) arg(a *Arg) {
+	if a.Composite != nil {
+		f.WriteString("(")
+		f.expression(a.Composite)
+		f.WriteString(")")
+		return
+	}
+	f.comparable(a.Comparable)
+}
+
+func (f *formatter) comparable(c *Comparable) {
+	if c.Function != nil {
+		f.WriteString(c.Function.QualifiedName)
+		f.WriteString("(")
+		for i, arg := range c.Function.Args {
+			if i > 0 {
+				f.WriteString(", ")
+			}
+			f.arg(arg)
+		}
+		f.WriteString(")")
+		return
+	}
+	m := c.Member
+	if len(m.Fields) == 0 {
+		f.WriteString(formatValue(m.Value))
+		return
+	}
+	f.WriteString(m.Value)
+	for _, field := range m.Fields {
+		f.WriteString(".")
+		f.WriteString(field)
+	}
+}
+
+// textRE matches values which are lexed as a single TEXT token.
+var textRE = regexp.MustCompile(`^[^\s\.,<>=!:\(\)"\-][^\s\.,<>=!:\(\)]*$`)
+
+// formatValue returns a value as TEXT if possible, or as a quoted STRING.
+func formatValue(value string) string {
+	switch value {
+	case "AND", "OR", "NOT":
+		return strconv.Quote(value)
+	}
+	if textRE.MatchString(value) {
+		return value
+	}
+	return strconv.Quote(value)
+}
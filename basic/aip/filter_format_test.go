@@ -0,0 +1,87 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormat(t *testing.T) {
+	Convey("Format", t, func() {
+		// format parses and formats a filter, checking the formatted filter
+		// parses and formats to itself.
+		format := func(filter string) string {
+			f, err := ParseFilter(filter)
+			So(err, ShouldBeNil)
+			result := Format(f)
+			reparsed, err := ParseFilter(result)
+			So(err, ShouldBeNil)
+			So(Format(reparsed), ShouldEqual, result)
+			return result
+		}
+
+		Convey("Empty filters", func() {
+			So(format(``), ShouldEqual, ``)
+			So(Format(nil), ShouldEqual, ``)
+		})
+		Convey("Restrictions", func() {
+			So(format(`a`), ShouldEqual, `a`)
+			So(format(`a=b`), ShouldEqual, `a = b`)
+			So(format(`a   !=   b`), ShouldEqual, `a != b`)
+			So(format(`a.b.c >= 2.5`), ShouldEqual, `a.b.c >= 2.5`)
+			So(format(`a : b`), ShouldEqual, `a:b`)
+		})
+		Convey("Sequences, conjunctions and disjunctions", func() {
+			So(format(`a b   c`), ShouldEqual, `a b c`)
+			So(format(`a AND b`), ShouldEqual, `a AND b`)
+			So(format(`a OR b OR c`), ShouldEqual, `a OR b OR c`)
+			So(format(`-a`), ShouldEqual, `NOT a`)
+			So(format(`NOT a = b`), ShouldEqual, `NOT a = b`)
+		})
+		Convey("Values", func() {
+			So(format(`"hello world"`), ShouldEqual, `"hello world"`)
+			So(format(`a = "b"`), ShouldEqual, `a = b`)
+			So(format(`a = "-30"`), ShouldEqual, `a = "-30"`)
+			So(format(`a = "AND"`), ShouldEqual, `a = "AND"`)
+			So(format(`a = "a.b"`), ShouldEqual, `a = "a.b"`)
+			So(format(`a = ""`), ShouldEqual, `a = ""`)
+			So(format(`a = "say \"hi\""`), ShouldEqual, `a = "say \"hi\""`)
+		})
+		Convey("Parentheses", func() {
+			So(format(`(a)`), ShouldEqual, `a`)
+			So(format(`((a = b))`), ShouldEqual, `a = b`)
+			So(format(`NOT (a)`), ShouldEqual, `NOT a`)
+			So(format(`NOT (NOT a)`), ShouldEqual, `NOT (NOT a)`)
+			So(format(`NOT (a b)`), ShouldEqual, `NOT (a b)`)
+			So(format(`NOT ((a b))`), ShouldEqual, `NOT (a b)`)
+			So(format(`NOT (a OR b)`), ShouldEqual, `NOT (a OR b)`)
+			So(format(`(a OR b) c`), ShouldEqual, `a OR b c`)
+			So(format(`a OR (b OR c)`), ShouldEqual, `a OR b OR c`)
+			So(format(`a OR (b c)`), ShouldEqual, `a OR (b c)`)
+			So(format(`a OR (b AND c)`), ShouldEqual, `a OR (b AND c)`)
+			So(format(`a AND (b c)`), ShouldEqual, `a AND b c`)
+			So(format(`a (b AND c) d`), ShouldEqual, `a b AND c d`)
+			So(format(`(a OR (b AND c)) d`), ShouldEqual, `a OR (b AND c) d`)
+			So(format(`a = (b OR c)`), ShouldEqual, `a = (b OR c)`)
+		})
+		Convey("Functions", func() {
+			So(format(`f()`), ShouldEqual, `f()`)
+			So(format(`math.mem("30 mb" , x)`), ShouldEqual, `math.mem("30 mb", x)`)
+			So(format(`create_time > ago(3600) OR  f(a)=f(b)`), ShouldEqual, `create_time > ago(3600) OR f(a) = f(b)`)
+		})
+	})
+}
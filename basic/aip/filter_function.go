@@ -0,0 +1,143 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SQLFunction translates a call to an AIP-160 filter function into an
+// injection-safe SQL expression.
+//
+// A function used on its own, e.g. `startsWith(name, "x")`, must translate
+// to a boolean expression. A function used as an argument, e.g.
+// `create_time > ago(3600)`, must translate to a value comparable with the
+// column.
+//
+// User input MUST only reach the returned SQL through FunctionCall.Bind
+// and column names through FunctionCall.Column. With positional dialects,
+// values must be bound in the order their placeholders appear in the
+// returned SQL.
+type SQLFunction func(call *FunctionCall) (string, error)
+
+// FunctionCall is a call to a filter function being translated to SQL.
+type FunctionCall struct {
+	// Function is the parsed function call.
+	Function *Function
+
+	w *whereClause
+}
+
+// Bind binds a new query parameter with the given value, and returns
+// the placeholder referencing it.
+func (c *FunctionCall) Bind(value any) string {
+	return c.w.bind(value)
+}
+
+// Column returns the quoted database name of the filterable column
+// referenced by the i-th argument.
+func (c *FunctionCall) Column(i int) (string, error) {
+	member, err := c.member(i)
+	if err != nil {
+		return "", err
+	}
+	column, fields, err := c.w.table.filterableColumnByMember(member)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) > 0 {
+		return "", fmt.Errorf("argument %d of function %s must be a field, got %s", i, c.Function.QualifiedName, memberText(member))
+	}
+	return c.w.columnName(column), nil
+}
+
+// Literal returns the text of the i-th argument, which must be a literal
+// value such as 42, 2.5 or "text".
+func (c *FunctionCall) Literal(i int) (string, error) {
+	member, err := c.member(i)
+	if err != nil {
+		return "", err
+	}
+	return memberText(member), nil
+}
+
+// member returns the member of the i-th argument.
+func (c *FunctionCall) member(i int) (*Member, error) {
+	if i < 0 || i >= len(c.Function.Args) {
+		return nil, fmt.Errorf("function %s expects at least %d arguments, got %d", c.Function.QualifiedName, i+1, len(c.Function.Args))
+	}
+	arg := c.Function.Args[i]
+	if arg.Comparable == nil || arg.Comparable.Member == nil {
+		return nil, fmt.Errorf("argument %d of function %s must be a field or a literal", i, c.Function.QualifiedName)
+	}
+	return arg.Comparable.Member, nil
+}
+
+// functionQuery returns the SQL expression equivalent to the given
+// function call.
+// The returned string is an injection-safe SQL expression.
+func (w *whereClause) functionQuery(function *Function) (string, error) {
+	f, ok := w.table.functions[function.QualifiedName]
+	if !ok {
+		names := make([]string, 0, len(w.table.functions))
+		for name := range w.table.functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("no function named %q, valid functions are %s", function.QualifiedName, strings.Join(names, ", "))
+	}
+	result, err := f(&FunctionCall{Function: function, w: w})
+	if err != nil {
+		return "", fmt.Errorf("function %s: %w", function.QualifiedName, err)
+	}
+	return result, nil
+}
+
+// functionRestrictionQuery returns the SQL expression equivalent to the
+// given restriction on a function call.
+// The returned string is an injection-safe SQL expression.
+func (w *whereClause) functionRestrictionQuery(restriction *Restriction) (string, error) {
+	function, err := w.functionQuery(restriction.Comparable.Function)
+	if err != nil {
+		return "", err
+	}
+	if restriction.Comparator == "" {
+		return "(" + function + ")", nil
+	}
+	operator := restriction.Comparator
+	switch {
+	case operator == "=":
+	case operator == "!=":
+		operator = "<>"
+	case isOrderingComparator(operator):
+	default:
+		return "", fmt.Errorf("cannot use %s operator on function %s", restriction.Comparator, restriction.Comparable.Function.QualifiedName)
+	}
+	if restriction.Arg.Composite != nil {
+		return "", fmt.Errorf("composite expressions in arguments not implemented yet")
+	}
+	var arg string
+	if restriction.Arg.Comparable.Function != nil {
+		if arg, err = w.functionQuery(restriction.Arg.Comparable.Function); err != nil {
+			return "", err
+		}
+	} else {
+		// Bind unsanitised user input to a parameter to protect against SQL injection.
+		arg = w.bind(memberText(restriction.Arg.Comparable.Member))
+	}
+	return fmt.Sprintf("(%s %s %s)", function, operator, arg), nil
+}
@@ -15,7 +15,9 @@
 package aip
 
 import (
+	"database/sql"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -26,15 +28,51 @@ import (
 // column definitions and a parsed AIP-160 filter.
 type whereClause struct {
 	table         *Table
+	dialect       Dialect
 	parameters    []QueryParameter
 	namePrefix    string
 	nextValueName int
+	// The number of query parameters preceding the parameters of the
+	// clause in the query.
+	parameterOffset int
 }
 
 // QueryParameter represents a query parameter.
 type QueryParameter struct {
-	Name  string
-	Value string
+	Name string
+	// Value is the value bound to the parameter. Its Go type depends on
+	// the type of the column it is compared against:
+	//   - ColumnTypeString: string
+	//   - ColumnTypeInt64: int64
+	//   - ColumnTypeFloat64: float64
+	//   - ColumnTypeTimestamp: time.Time
+	//   - ColumnTypeDuration: time.Duration, which database/sql passes
+	//     to the driver as int64 nanoseconds.
+	//
+	// Boolean arguments are never bound; they are emitted as TRUE or FALSE
+	// literals.
+	Value any
+}
+
+// NamedArgs converts query parameters into sql.NamedArg arguments, in
+// the form expected by database/sql and GORM for queries using named
+// placeholders (e.g. @p_0).
+func NamedArgs(parameters []QueryParameter) []any {
+	args := make([]any, 0, len(parameters))
+	for _, p := range parameters {
+		args = append(args, sql.Named(p.Name, p.Value))
+	}
+	return args
+}
+
+// PositionalArgs returns the values of the query parameters in the order
+// they were bound, for queries using positional placeholders.
+func PositionalArgs(parameters []QueryParameter) []any {
+	args := make([]any, 0, len(parameters))
+	for _, p := range parameters {
+		args = append(args, p.Value)
+	}
+	return args
 }
 
 // WhereClause creates a Standard SQL WHERE clause fragment for the given filter.
@@ -42,17 +80,24 @@ type QueryParameter struct {
 // The fragment will be enclosed in parentheses and does not include the "WHERE" keyword.
 // For example: (column LIKE @param1)
 // Also returns the query parameters which need to be given to the database.
+// Placeholders and column quoting follow the Dialect of the table; with
+// positional dialects the parameters are returned in placeholder order.
 //
 // All field names are replaced with the safe database column names from the specified table.
 // All user input strings are passed via query parameters, so the returned query is SQL injection safe.
 func (t *Table) WhereClause(filter *Filter, parameterPrefix string) (string, []QueryParameter, error) {
+	if err := filter.Err(); err != nil {
+		return "", []QueryParameter{}, err
+	}
 	if filter.Expression == nil {
 		return "(TRUE)", []QueryParameter{}, nil
 	}
 
 	q := &whereClause{
-		table:      t,
-		namePrefix: parameterPrefix,
+		table:           t,
+		dialect:         t.Dialect(),
+		namePrefix:      parameterPrefix,
+		parameterOffset: t.parameterOffset,
 	}
 
 	clause, err := q.expressionQuery(filter.Expression)
@@ -140,6 +185,9 @@ func (w *whereClause) simpleQuery(simple *Simple) (string, error) {
 // restriction.
 // The returned string is an injection-safe SQL expression.
 func (w *whereClause) restrictionQuery(restriction *Restriction) (string, error) {
+	if restriction.Comparable.Function != nil {
+		return w.functionRestrictionQuery(restriction)
+	}
 	if restriction.Comparable.Member == nil {
 		return "", fmt.Errorf("invalid comparable")
 	}
@@ -158,68 +206,185 @@ func (w *whereClause) restrictionQuery(restriction *Restriction) (string, error)
 		// marked for implicit matching.
 		for _, column := range w.table.columns {
 			if column.implicitFilter {
-				clauses = append(clauses, fmt.Sprintf("%s LIKE %s", column.databaseName, arg))
+				if w.dialect.Positional() && len(clauses) > 0 {
+					// Positional parameters must be bound once per reference.
+					if arg, err = w.likeComparableValue(restriction.Comparable); err != nil {
+						return "", err
+					}
+				}
+				clauses = append(clauses, w.dialect.Like(w.columnName(column), arg))
 			}
 		}
 		return "(" + strings.Join(clauses, " OR ") + ")", nil
 	}
-	column, err := w.table.FilterableColumnByFieldPath(NewFieldPath(restriction.Comparable.Member.Value))
+	column, fields, err := w.table.filterableColumnByMember(restriction.Comparable.Member)
 	if err != nil {
 		return "", err
 	}
-	if len(restriction.Comparable.Member.Fields) > 0 {
+	if column.keyValue && isOrderingComparator(restriction.Comparator) {
+		return "", fmt.Errorf("ordering comparator %q cannot be used on key value column %q", restriction.Comparator, column.fieldPath.String())
+	}
+	if column.json {
+		return w.jsonRestrictionQuery(restriction, column, fields)
+	}
+	if len(fields) > 0 {
 		if !column.keyValue {
 			return "", fmt.Errorf("fields are only supported for key value columns.  Try removing the '.' from after your column named %q", column.fieldPath.String())
 		}
-		if len(restriction.Comparable.Member.Fields) > 1 {
+		if len(fields) > 1 {
 			return "", fmt.Errorf("expected only a single '.' in keyvalue column named %q", column.fieldPath.String())
 		}
-		key := w.bind(restriction.Comparable.Member.Fields[0])
+		key := w.bind(fields[0])
+		if restriction.Comparator == ":" && isWildcardArg(restriction.Arg) {
+			return "(" + w.dialect.HasKey(w.columnName(column), key) + ")", nil
+		}
 		if restriction.Comparator == ":" {
 			value, err := w.likeArgValue(restriction.Arg, column)
 			if err != nil {
 				return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
 			}
-			return fmt.Sprintf("(EXISTS (SELECT key, value FROM UNNEST(%s) WHERE key = %s AND value LIKE %s))", column.databaseName, key, value), nil
+			return "(" + w.dialect.KeyValue(w.columnName(column), key, func(v string) string {
+				return w.dialect.Like(v, value)
+			}) + ")", nil
 		}
 		value, err := w.argValue(restriction.Arg, column)
 		if err != nil {
 			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
 		}
 		if restriction.Comparator == "=" {
-			return fmt.Sprintf("(EXISTS (SELECT key, value FROM UNNEST(%s) WHERE key = %s AND value = %s))", column.databaseName, key, value), nil
+			return "(" + w.dialect.KeyValue(w.columnName(column), key, func(v string) string {
+				return fmt.Sprintf("%s = %s", v, value)
+			}) + ")", nil
 		} else if restriction.Comparator == "!=" {
-			return fmt.Sprintf("(EXISTS (SELECT key, value FROM UNNEST(%s) WHERE key = %s AND value <> %s))", column.databaseName, key, value), nil
+			return "(" + w.dialect.KeyValue(w.columnName(column), key, func(v string) string {
+				return fmt.Sprintf("%s <> %s", v, value)
+			}) + ")", nil
 		}
 		return "", fmt.Errorf("comparator operator not implemented for fields yet")
 	} else if column.keyValue {
-		// TODO: AIP-160 specifies the has operator on maps will check for the presence of a key.
+		if restriction.Comparator == ":" {
+			// AIP-160 specifies the has operator on maps checks for the presence of a key.
+			text, err := hasKeyText(restriction.Arg)
+			if err != nil {
+				return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+			}
+			return "(" + w.dialect.HasKey(w.columnName(column), w.bind(text)) + ")", nil
+		}
 		// nolint: lll
 		return "", fmt.Errorf("key value columns must specify the key to search on.  Instead of '%s%s' try '%s.key%s'", column.fieldPath.String(), restriction.Comparator, column.fieldPath.String(), restriction.Comparator)
+	} else if column.repeated {
+		if err := checkRepeatedComparator(restriction.Comparator, column); err != nil {
+			return "", err
+		}
+		// AIP-160 specifies the has operator on repeated fields checks whether an element matches.
+		comparable, err := elementComparable(restriction.Arg)
+		if err != nil {
+			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		value, err := literalValue(comparable, column)
+		if err != nil {
+			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		return "(" + w.dialect.Contains(w.columnName(column), w.literal(value), column.columnType) + ")", nil
+	}
+	return w.valueRestrictionQuery(restriction, column, w.columnName(column))
+}
+
+// jsonRestrictionQuery returns the SQL expression equivalent to the given
+// restriction on the value at the given fields of a JSON column.
+// The returned string is an injection-safe SQL expression.
+func (w *whereClause) jsonRestrictionQuery(restriction *Restriction, column *Column, fields []string) (string, error) {
+	path := append(slices.Clone(column.jsonPath), fields...)
+	if len(path) == 0 {
+		// nolint: lll
+		return "", fmt.Errorf("JSON columns must specify the field to search on.  Instead of '%s%s' try '%s.field%s'", column.fieldPath.String(), restriction.Comparator, column.fieldPath.String(), restriction.Comparator)
+	}
+	keys := make([]string, 0, len(path))
+	for _, key := range path {
+		keys = append(keys, w.bind(key))
+	}
+	value := w.dialect.JSONValue(w.columnName(column), keys, column.columnType)
+	if restriction.Comparator == ":" && isWildcardArg(restriction.Arg) {
+		return fmt.Sprintf("(%s IS NOT NULL)", value), nil
+	}
+	return w.valueRestrictionQuery(restriction, column, value)
+}
+
+// valueRestrictionQuery returns the SQL expression equivalent to the given
+// restriction on a scalar value of the column, given by the expression.
+// The returned string is an injection-safe SQL expression.
+func (w *whereClause) valueRestrictionQuery(restriction *Restriction, column *Column, expr string) (string, error) {
+	if restriction.Comparator == "=" || restriction.Comparator == "!=" {
+		text, ok, err := wildcardText(restriction.Arg, column)
+		if err != nil {
+			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		if ok {
+			// Bind unsanitised user input to a parameter to protect against SQL injection.
+			like := w.dialect.Like(expr, w.bind(wildcardLike(text)))
+			if restriction.Comparator == "!=" {
+				return "(NOT " + like + ")", nil
+			}
+			return "(" + like + ")", nil
+		}
 	}
 	if restriction.Comparator == "=" {
 		arg, err := w.argValue(restriction.Arg, column)
 		if err != nil {
 			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
 		}
-		return fmt.Sprintf("(%s = %s)", column.databaseName, arg), nil
+		return fmt.Sprintf("(%s = %s)", expr, arg), nil
 	} else if restriction.Comparator == "!=" {
 		arg, err := w.argValue(restriction.Arg, column)
 		if err != nil {
 			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
 		}
-		return fmt.Sprintf("(%s <> %s)", column.databaseName, arg), nil
+		return fmt.Sprintf("(%s <> %s)", expr, arg), nil
 	} else if restriction.Comparator == ":" {
 		arg, err := w.likeArgValue(restriction.Arg, column)
 		if err != nil {
 			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
 		}
-		return fmt.Sprintf("(%s LIKE %s)", column.databaseName, arg), nil
+		return "(" + w.dialect.Like(expr, arg) + ")", nil
+	} else if isOrderingComparator(restriction.Comparator) {
+		if column.columnType == ColumnTypeBool {
+			return "", fmt.Errorf("ordering comparator %q cannot be used on boolean field %q", restriction.Comparator, column.fieldPath.String())
+		}
+		if column.argSubstitute != nil {
+			return "", fmt.Errorf("cannot use ordering comparator %q on a field that have argSubstitute function", restriction.Comparator)
+		}
+		arg, err := w.argValue(restriction.Arg, column)
+		if err != nil {
+			return "", errors.WithMessagef(errors.WithStack(err), "argument for field %s", column.fieldPath.String())
+		}
+		return fmt.Sprintf("(%s %s %s)", expr, restriction.Comparator, arg), nil
 	} else {
 		return "", fmt.Errorf("comparator operator not implemented yet")
 	}
 }
 
+// isOrderingComparator returns whether the comparator is one of the
+// ordering comparators <, <=, > and >=.
+func isOrderingComparator(comparator string) bool {
+	switch comparator {
+	case "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// checkRepeatedComparator returns an error if the comparator cannot be
+// used on the repeated column, which only supports the has operator.
+func checkRepeatedComparator(comparator string, column *Column) error {
+	if isOrderingComparator(comparator) {
+		return fmt.Errorf("ordering comparator %q cannot be used on repeated field %q", comparator, column.fieldPath.String())
+	}
+	if comparator != ":" {
+		return fmt.Errorf("only the has operator (:) can be used on repeated field %q, e.g. %s:value", column.fieldPath.String(), column.fieldPath.String())
+	}
+	return nil
+}
+
 // argValue returns a SQL expression representing the value of the specified
 // arg.
 // The returned string is an injection-safe SQL expression.
@@ -233,33 +398,32 @@ func (w *whereClause) argValue(arg *Arg, column *Column) (string, error) {
 	return w.comparableValue(arg.Comparable, column)
 }
 
-// argValue returns a SQL expression representing the value of the specified
+// comparableValue returns a SQL expression representing the value of the specified
 // comparable.
 // The returned string is an injection-safe SQL expression.
 func (w *whereClause) comparableValue(comparable *Comparable, column *Column) (string, error) {
-	if comparable.Member == nil {
-		return "", fmt.Errorf("invalid comparable")
+	if comparable.Function != nil {
+		return w.functionQuery(comparable.Function)
 	}
-	if len(comparable.Member.Fields) > 0 {
-		return "", fmt.Errorf("fields not implemented yet")
+	value, err := literalValue(comparable, column)
+	if err != nil {
+		return "", err
 	}
-	switch column.columnType {
-	case ColumnTypeString:
-		value := comparable.Member.Value
-		if column.argSubstitute != nil {
-			value = column.argSubstitute(value)
-		}
-		// Bind unsanitised user input to a parameter to protect against SQL injection.
-		return w.bind(value), nil
-	case ColumnTypeBool:
-		if strings.EqualFold(comparable.Member.Value, "true") {
-			return "TRUE", nil
-		} else if strings.EqualFold(comparable.Member.Value, "false") {
-			return "FALSE", nil
+	return w.literal(value), nil
+}
+
+// literal returns a SQL expression representing the given value: a TRUE
+// or FALSE literal for booleans, or a query parameter bound to the value.
+// The returned string is an injection-safe SQL expression.
+func (w *whereClause) literal(value any) string {
+	if b, ok := value.(bool); ok {
+		if b {
+			return "TRUE"
 		}
-		return "", fmt.Errorf("only TRUE or FALSE can be specified as the value for a boolean field")
+		return "FALSE"
 	}
-	return "", fmt.Errorf("unable to generate SQL value for unknown field type: %s", column.columnType.String())
+	// Bind unsanitised user input to a parameter to protect against SQL injection.
+	return w.bind(value)
 }
 
 // likeArgValue returns a SQL expression that, when passed to the
@@ -267,19 +431,12 @@ func (w *whereClause) comparableValue(comparable *Comparable, column *Column) (s
 // the value of the argument.
 // The returned string is an injection-safe SQL expression.
 func (w *whereClause) likeArgValue(arg *Arg, column *Column) (string, error) {
-	if arg.Composite != nil {
-		return "", fmt.Errorf("composite expressions are not allowed as RHS to has (:) operator")
-	}
-	if arg.Comparable == nil {
-		return "", fmt.Errorf("missing comparable in argument")
-	}
-	if column.columnType != ColumnTypeString {
-		return "", fmt.Errorf("cannot use has (:) operator on a non-string field %q", column.columnType.String())
-	}
-	if column.argSubstitute != nil {
-		return "", fmt.Errorf("cannot use has (:) operator on a field that have argSubstitute function")
+	value, err := likeArgText(arg, column)
+	if err != nil {
+		return "", err
 	}
-	return w.likeComparableValue(arg.Comparable)
+	// Bind unsanitised user input to a parameter to protect against SQL injection.
+	return w.bind("%" + QuoteLike(value) + "%"), nil
 }
 
 // likeComparableValue returns a SQL expression that, when passed to the
@@ -287,22 +444,26 @@ func (w *whereClause) likeArgValue(arg *Arg, column *Column) (string, error) {
 // the value of the comparable.
 // The returned string is an injection-safe SQL expression.
 func (w *whereClause) likeComparableValue(comparable *Comparable) (string, error) {
-	if comparable.Member == nil {
-		return "", fmt.Errorf("invalid comparable")
-	}
-	if len(comparable.Member.Fields) > 0 {
-		return "", fmt.Errorf("fields are not allowed on the RHS of has (:) operator")
+	value, err := likeComparableText(comparable)
+	if err != nil {
+		return "", err
 	}
 	// Bind unsanitised user input to a parameter to protect against SQL injection.
-	return w.bind("%" + QuoteLike(comparable.Member.Value) + "%"), nil
+	return w.bind("%" + QuoteLike(value) + "%"), nil
 }
 
 // bind binds a new query parameter with the given value, and returns
-// the name of the parameter (including '@').
+// the dialect specific placeholder referencing it (e.g. '@name').
 // The returned string is an injection-safe SQL expression.
-func (w *whereClause) bind(value string) string {
+func (w *whereClause) bind(value any) string {
 	name := w.namePrefix + strconv.Itoa(w.nextValueName)
 	w.nextValueName += 1
 	w.parameters = append(w.parameters, QueryParameter{Name: name, Value: value})
-	return "@" + name
+	return w.dialect.Placeholder(name, w.parameterOffset+len(w.parameters))
+}
+
+// columnName returns the quoted database name of the column.
+// The returned string is an injection-safe SQL expression.
+func (w *whereClause) columnName(column *Column) string {
+	return w.dialect.QuoteIdentifier(column.databaseName)
 }
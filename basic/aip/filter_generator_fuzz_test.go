@@ -0,0 +1,299 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+// This file checks WhereClause is SQL injection safe for any filter
+// accepted by ParseFilter: the generated SQL is made only of the column
+// names of the table, placeholders, and the fixed keywords, operators and
+// literals of the dialects and functions, so that every user literal can
+// only reach the database through a query parameter.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// whereClauseTestFilters are the seed filters of FuzzWhereClause.
+var whereClauseTestFilters = []string{
+	`somevalue`,
+	`"some value" other`,
+	`foo:somevalue`,
+	`foo = "x" AND bar != y OR -baz:z`,
+	`NOT (foo = a OR bar = b) c`,
+	`kv.key = value`,
+	`kv.key != value AND kv.key:val`,
+	`kv.key > value`,
+	`kv:env OR kv.key:* OR kv:"'"`,
+	`bool = true AND NOT bool = FALSE`,
+	`int = 42 AND int < -5 AND float >= -2.5 AND duration > -20s`,
+	`time > "2024-01-02T03:04:05Z" AND duration < 1.5s`,
+	`qux = somevalue AND quux.key = somevalue`,
+	`startsWith(foo, "a_b%") AND time > time.ago(3600)`,
+	`time.ago(60) < time`,
+	`foo = "'; DROP TABLE users; --"`,
+	`foo = "\" OR 1=1 --"`,
+	`kv."'key'" = "` + "`" + `" AND "` + "`db_foo`" + `"`,
+	`foo = db_foo AND db_foo`,
+	`foo:"%_\\"`,
+	`unknown = 1`,
+	`tags:urgent AND scores:42 AND -flags:true`,
+	`tags = x OR scores > 1`,
+	`spec.owner.team = "x" AND spec.replicas > 2 AND spec.name:web`,
+	`spec.owner:* OR spec = x OR spec."'".b != "]"`,
+	`host = "*.example_%.com" AND host != "*" AND parent = "a/*" AND parent = "*/a"`,
+}
+
+// newWhereClauseTestTable returns a table with every kind of column, using
+// the given dialect.
+func newWhereClauseTestTable(dialect Dialect) *Table {
+	subFunc := func(sub string) string {
+		if sub == "somevalue" {
+			return "somevalue-v2"
+		}
+		return sub
+	}
+	return NewTable().WithColumns(
+		NewColumn().WithFieldPath("foo").WithDatabaseName("db_foo").FilterableImplicitly().Build(),
+		NewColumn().WithFieldPath("bar").WithDatabaseName("db_bar").FilterableImplicitly().Build(),
+		NewColumn().WithFieldPath("baz").WithDatabaseName("db_baz").Filterable().Build(),
+		NewColumn().WithFieldPath("kv").WithDatabaseName("db_kv").KeyValue().Filterable().Build(),
+		NewColumn().WithFieldPath("bool").WithDatabaseName("db_bool").Bool().Filterable().Build(),
+		NewColumn().WithFieldPath("int").WithDatabaseName("db_int").Int64().Filterable().Build(),
+		NewColumn().WithFieldPath("float").WithDatabaseName("db_float").Float64().Filterable().Build(),
+		NewColumn().WithFieldPath("time").WithDatabaseName("db_time").Timestamp().Filterable().Build(),
+		NewColumn().WithFieldPath("duration").WithDatabaseName("db_duration").Duration().Filterable().Build(),
+		NewColumn().WithFieldPath("unfilterable").WithDatabaseName("unfilterable").Build(),
+		NewColumn().WithFieldPath("qux").WithDatabaseName("db_qux").WithArgumentSubstitutor(subFunc).Filterable().Build(),
+		NewColumn().WithFieldPath("quux").WithDatabaseName("db_quux").WithArgumentSubstitutor(subFunc).Filterable().KeyValue().Build(),
+		NewColumn().WithFieldPath("tags").WithDatabaseName("db_tags").Repeated().Filterable().Build(),
+		NewColumn().WithFieldPath("scores").WithDatabaseName("db_scores").Int64().Repeated().Filterable().Build(),
+		NewColumn().WithFieldPath("flags").WithDatabaseName("db_flags").Bool().Repeated().Filterable().Build(),
+		NewColumn().WithFieldPath("spec").WithDatabaseName("db_spec").JSON().Filterable().Build(),
+		NewColumn().WithFieldPath("spec", "replicas").WithDatabaseName("db_spec").JSON("replicas").Int64().Filterable().Build(),
+		NewColumn().WithFieldPath("spec", "ready").WithDatabaseName("db_spec").JSON("ready").Bool().Filterable().Build(),
+		NewColumn().WithFieldPath("spec", "ratio").WithDatabaseName("db_spec").JSON("ratio").Float64().Filterable().Build(),
+		NewColumn().WithFieldPath("spec", "time").WithDatabaseName("db_spec").JSON("time").Timestamp().Filterable().Build(),
+		NewColumn().WithFieldPath("host").WithDatabaseName("db_host").WithWildcards().Filterable().Build(),
+		NewColumn().WithFieldPath("parent").WithDatabaseName("db_parent").WithPrefixWildcards().Filterable().Build(),
+	).WithFunction("startsWith", func(call *FunctionCall) (string, error) {
+		column, err := call.Column(0)
+		if err != nil {
+			return "", err
+		}
+		prefix, err := call.Literal(1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s LIKE %s", column, call.Bind(QuoteLike(prefix)+"%")), nil
+	}).WithFunction("time.ago", func(call *FunctionCall) (string, error) {
+		seconds, err := call.Literal(0)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL %s SECOND)", call.Bind(seconds)), nil
+	}).WithDialect(dialect).Build()
+}
+
+// safeSQLKeywords are the unquoted words which may appear in the SQL
+// generated by the dialects and the functions of the test table.
+var safeSQLKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "ESCAPE": true,
+	"TRUE": true, "FALSE": true, "EXISTS": true, "SELECT": true,
+	"FROM": true, "WHERE": true, "UNNEST": true, "key": true, "value": true,
+	"JSON_UNQUOTE": true, "JSON_EXTRACT": true, "CONCAT": true,
+	"JSON_QUOTE": true, "JSON_CONTAINS_PATH": true, "json_each": true,
+	"jsonb_each_text": true, "COALESCE": true, "CASE": true, "WHEN": true,
+	"THEN": true, "END": true, "jsonb_typeof": true, "jsonb_extract_path": true,
+	"jsonb_exists": true, "1": true, "IN": true, "ANY": true,
+	"JSON_CONTAINS": true, "JSON_ARRAY": true, "IF": true, "IS": true, "NULL": true,
+	"JSON_VALUE": true, "CAST": true, "SAFE_CAST": true, "AS": true, "BOOL": true,
+	"INT64": true, "FLOAT64": true, "TIMESTAMP": true, "SIGNED": true,
+	"DOUBLE": true, "DATETIME": true, "6": true, "BOOLEAN": true,
+	"BIGINT": true, "PRECISION": true, "TIMESTAMPTZ": true,
+	"jsonb_extract_path_text": true, "json_extract": true, "json_quote": true,
+	"TIMESTAMP_SUB": true, "CURRENT_TIMESTAMP": true, "INTERVAL": true,
+	"SECOND": true,
+}
+
+// safeSQLLiterals are the string literals which may appear in the SQL
+// generated by the dialects.
+var safeSQLLiterals = map[string]bool{
+	`'\'`: true, `'$.'`: true, `'.'`: true, `'one'`: true,
+	`'boolean'`: true, `'number'`: true, `'string'`: true,
+	`'true'`: true, `'false'`: true,
+}
+
+func TestWhereClauseInjectionSafety(t *testing.T) {
+	for _, filter := range whereClauseTestFilters {
+		t.Run(filter, func(t *testing.T) {
+			checkWhereClause(t, filter)
+		})
+	}
+}
+
+func TestCheckSafeSQL(t *testing.T) {
+	table := newWhereClauseTestTable(PostgreSQL)
+	parameters := []QueryParameter{{Name: "p_0", Value: "x"}}
+	tests := []struct {
+		clause string
+		safe   bool
+	}{
+		{clause: `("db_foo" LIKE $1 ESCAPE '\')`, safe: true},
+		{clause: `(("db_kv" ->> $1) = TRUE)`, safe: true},
+		{clause: `("db_foo" = 'x' OR $1)`},
+		{clause: `("db_foo" = x OR $1)`},
+		{clause: `("users" = $1)`},
+		{clause: `("db_foo" = $2)`},
+		{clause: `("db_foo" = TRUE)`},
+		{clause: `("db_foo" = $1); --`},
+	}
+	for _, test := range tests {
+		err := checkSafeSQL(table, test.clause, parameters)
+		if test.safe && err != nil {
+			t.Errorf("expected %s to be safe, got %s", test.clause, err)
+		}
+		if !test.safe && err == nil {
+			t.Errorf("expected %s to be unsafe", test.clause)
+		}
+	}
+}
+
+func FuzzWhereClause(f *testing.F) {
+	for _, filter := range whereClauseTestFilters {
+		f.Add(filter)
+	}
+	f.Fuzz(checkWhereClause)
+}
+
+// checkWhereClause checks the WHERE clauses generated for the filter with
+// every dialect are injection safe.
+func checkWhereClause(t *testing.T, text string) {
+	filter, err := ParseFilter(text)
+	if err != nil {
+		return
+	}
+	for _, dialect := range []Dialect{defaultDialect, Spanner, MySQL, PostgreSQL, SQLite} {
+		table := newWhereClauseTestTable(dialect)
+		clause, parameters, err := table.WhereClause(filter, "p_")
+		if err != nil {
+			continue
+		}
+		if err := checkSafeSQL(table, clause, parameters); err != nil {
+			t.Errorf("unsafe SQL generated with %T for filter %q: %s\nSQL: %s", dialect, text, err, clause)
+		}
+	}
+}
+
+// checkSafeSQL checks the SQL is made only of the columns of the table,
+// placeholders referencing the parameters, and safe keywords, literals
+// and operators. It also checks every parameter is referenced.
+func checkSafeSQL(table *Table, clause string, parameters []QueryParameter) error {
+	dialect := table.Dialect()
+	columns := make(map[string]bool)
+	for _, column := range table.columns {
+		columns[dialect.QuoteIdentifier(column.databaseName)] = true
+	}
+	names := make(map[string]bool)
+	for _, p := range parameters {
+		names[p.Name] = true
+	}
+	referenced := make(map[string]bool)
+	positional := 0
+
+	for i := 0; i < len(clause); {
+		c := clause[i]
+		switch {
+		case c == ' ':
+			i++
+		case strings.HasPrefix(clause[i:], "->>"):
+			i += 3
+		case strings.HasPrefix(clause[i:], "<>"), strings.HasPrefix(clause[i:], "<="), strings.HasPrefix(clause[i:], ">="),
+			strings.HasPrefix(clause[i:], "||"):
+			i += 2
+		case strings.IndexByte("()[]<>=,", c) >= 0:
+			i++
+		case c == '\'':
+			end := strings.IndexByte(clause[i+1:], '\'')
+			if end < 0 || !safeSQLLiterals[clause[i:i+end+2]] {
+				return fmt.Errorf("unexpected string literal at %d", i)
+			}
+			i += end + 2
+		case c == '`' || c == '"':
+			end := strings.IndexByte(clause[i+1:], c)
+			if end < 0 || !columns[clause[i:i+end+2]] {
+				return fmt.Errorf("unexpected quoted identifier at %d", i)
+			}
+			i += end + 2
+		case c == '?':
+			positional++
+			i++
+		case c == '@':
+			n := sqlWordLength(clause[i+1:])
+			if !names[clause[i+1:i+1+n]] {
+				return fmt.Errorf("unknown named placeholder at %d", i)
+			}
+			referenced[clause[i+1:i+1+n]] = true
+			i += n + 1
+		case c == '$':
+			n := sqlWordLength(clause[i+1:])
+			index, err := strconv.Atoi(clause[i+1 : i+1+n])
+			if err != nil || index < 1 || index > len(parameters) {
+				return fmt.Errorf("unknown numbered placeholder at %d", i)
+			}
+			referenced[parameters[index-1].Name] = true
+			i += n + 1
+		default:
+			n := sqlWordLength(clause[i:])
+			if n == 0 {
+				return fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			word := clause[i : i+n]
+			if !safeSQLKeywords[word] && !columns[word] {
+				return fmt.Errorf("unexpected word %q at %d", word, i)
+			}
+			i += n
+		}
+	}
+
+	if dialect.Positional() {
+		if positional != len(parameters) {
+			return fmt.Errorf("%d placeholders for %d parameters", positional, len(parameters))
+		}
+		return nil
+	}
+	if positional > 0 {
+		return fmt.Errorf("positional placeholder with a named dialect")
+	}
+	if len(referenced) != len(parameters) {
+		return fmt.Errorf("%d parameters are referenced out of %d", len(referenced), len(parameters))
+	}
+	return nil
+}
+
+// sqlWordLength returns the length of the identifier, keyword or number
+// at the start of s, which may be qualified with dots.
+func sqlWordLength(s string) int {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c != '_' && c != '.' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			break
+		}
+		n++
+	}
+	return n
+}
@@ -15,7 +15,10 @@
 package aip
 
 import (
+	"database/sql"
+	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
 	. "github.com/smartystreets/goconvey/convey"
@@ -35,9 +38,20 @@ func TestWhereClause(t *testing.T) {
 			NewColumn().WithFieldPath("baz").WithDatabaseName("db_baz").Filterable().Build(),
 			NewColumn().WithFieldPath("kv").WithDatabaseName("db_kv").KeyValue().Filterable().Build(),
 			NewColumn().WithFieldPath("bool").WithDatabaseName("db_bool").Bool().Filterable().Build(),
+			NewColumn().WithFieldPath("int").WithDatabaseName("db_int").Int64().Filterable().Build(),
+			NewColumn().WithFieldPath("float").WithDatabaseName("db_float").Float64().Filterable().Build(),
+			NewColumn().WithFieldPath("time").WithDatabaseName("db_time").Timestamp().Filterable().Build(),
+			NewColumn().WithFieldPath("duration").WithDatabaseName("db_duration").Duration().Filterable().Build(),
 			NewColumn().WithFieldPath("unfilterable").WithDatabaseName("unfilterable").Build(),
 			NewColumn().WithFieldPath("qux").WithDatabaseName("db_qux").WithArgumentSubstitutor(subFunc).Filterable().Build(),
 			NewColumn().WithFieldPath("quux").WithDatabaseName("db_quux").WithArgumentSubstitutor(subFunc).Filterable().KeyValue().Build(),
+			NewColumn().WithFieldPath("tags").WithDatabaseName("db_tags").Repeated().Filterable().Build(),
+			NewColumn().WithFieldPath("scores").WithDatabaseName("db_scores").Int64().Repeated().Filterable().Build(),
+			NewColumn().WithFieldPath("flags").WithDatabaseName("db_flags").Bool().Repeated().Filterable().Build(),
+			NewColumn().WithFieldPath("spec").WithDatabaseName("db_spec").JSON().Filterable().Build(),
+			NewColumn().WithFieldPath("spec", "replicas").WithDatabaseName("db_spec").JSON("replicas").Int64().Filterable().Build(),
+			NewColumn().WithFieldPath("host").WithDatabaseName("db_host").WithWildcards().Filterable().Build(),
+			NewColumn().WithFieldPath("parent").WithDatabaseName("db_parent").WithPrefixWildcards().Filterable().Build(),
 		).Build()
 
 		Convey("Empty filter", func() {
@@ -107,6 +121,123 @@ func TestWhereClause(t *testing.T) {
 				So(pars, ShouldBeNil)
 				So(result, ShouldEqual, "((db_bool <> TRUE) AND (db_bool <> FALSE))")
 			})
+			Convey("ordering operators", func() {
+				filter, err := ParseFilter("foo < a AND foo <= b AND baz > c AND baz >= d")
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: "a",
+					},
+					{
+						Name:  "p_1",
+						Value: "b",
+					},
+					{
+						Name:  "p_2",
+						Value: "c",
+					},
+					{
+						Name:  "p_3",
+						Value: "d",
+					},
+				})
+				So(result, ShouldEqual, "((db_foo < @p_0) AND (db_foo <= @p_1) AND (db_baz > @p_2) AND (db_baz >= @p_3))")
+			})
+			Convey("ordering operator on bool column", func() {
+				filter, err := ParseFilter("bool > false")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "ordering comparator \">\" cannot be used on boolean field \"bool\"")
+			})
+			Convey("ordering operator on key value column", func() {
+				filter, err := ParseFilter("kv.key >= somevalue")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "ordering comparator \">=\" cannot be used on key value column \"kv\"")
+			})
+			Convey("ordering operator with argument substitutor", func() {
+				filter, err := ParseFilter("qux < somevalue")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "cannot use ordering comparator \"<\" on a field that have argSubstitute function")
+			})
+			Convey("typed columns", func() {
+				filter, err := ParseFilter(`int > 3 AND float <= 2.5 AND time >= "2024-01-02T03:04:05Z" AND duration != 1.5s`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: int64(3),
+					},
+					{
+						Name:  "p_1",
+						Value: 2.5,
+					},
+					{
+						Name:  "p_2",
+						Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+					},
+					{
+						Name:  "p_3",
+						Value: 1500 * time.Millisecond,
+					},
+				})
+				So(result, ShouldEqual, "((db_int > @p_0) AND (db_float <= @p_1) AND (db_time >= @p_2) AND (db_duration <> @p_3))")
+			})
+			Convey("negative typed arguments", func() {
+				filter, err := ParseFilter(`int > -3 AND float <= -2.5 AND duration != -1.5s`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: int64(-3),
+					},
+					{
+						Name:  "p_1",
+						Value: -2.5,
+					},
+					{
+						Name:  "p_2",
+						Value: -1500 * time.Millisecond,
+					},
+				})
+				So(result, ShouldEqual, "((db_int > @p_0) AND (db_float <= @p_1) AND (db_duration <> @p_2))")
+			})
+			Convey("invalid typed arguments", func() {
+				cases := map[string]string{
+					"int = 1.5":        "expected an integer value but got \"1.5\"",
+					"float = abc":      "expected a numeric value but got \"abc\"",
+					"time = yesterday": "expected an RFC 3339 timestamp",
+					"duration = 20m":   "expected a duration in seconds",
+				}
+				for input, expected := range cases {
+					filter, err := ParseFilter(input)
+					So(err, ShouldEqual, nil)
+
+					_, _, err = table.WhereClause(filter, "p_")
+					So(err, ShouldErrLike, expected)
+				}
+			})
+			Convey("has operator on typed column", func() {
+				filter, err := ParseFilter("int:3")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "cannot use has (:) operator on a non-string field \"INT64\"")
+			})
 			Convey("implicit match operator", func() {
 				filter, err := ParseFilter("somevalue")
 				So(err, ShouldEqual, nil)
@@ -175,13 +306,170 @@ func TestWhereClause(t *testing.T) {
 				})
 				So(result, ShouldEqual, "(EXISTS (SELECT key, value FROM UNNEST(db_kv) WHERE key = @p_0 AND value <> @p_1))")
 			})
-			Convey("key value missing key contains operator", func() {
-				filter, err := ParseFilter("kv:somevalue")
+			Convey("key value key presence", func() {
+				filter, err := ParseFilter("kv:somekey")
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: "somekey",
+					},
+				})
+				So(result, ShouldEqual, "(EXISTS (SELECT key FROM UNNEST(db_kv) WHERE key = @p_0))")
+			})
+			Convey("key value key presence with wildcard", func() {
+				filter, err := ParseFilter("kv.somekey:*")
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: "somekey",
+					},
+				})
+				So(result, ShouldEqual, "(EXISTS (SELECT key FROM UNNEST(db_kv) WHERE key = @p_0))")
+			})
+			Convey("key value key presence with a function", func() {
+				filter, err := ParseFilter("kv:f(x)")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "argument for field kv: functions are not allowed on the RHS of has (:) operator")
+			})
+			Convey("key value missing key equals operator", func() {
+				filter, err := ParseFilter("kv=somevalue")
 				So(err, ShouldEqual, nil)
 
 				_, _, err = table.WhereClause(filter, "p_")
 				So(err, ShouldErrLike, "key value columns must specify the key to search on")
 			})
+			Convey("repeated element operator", func() {
+				filter, err := ParseFilter("tags:urgent AND scores:42 AND -flags:true")
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: "urgent",
+					},
+					{
+						Name:  "p_1",
+						Value: int64(42),
+					},
+				})
+				So(result, ShouldEqual, "((@p_0 IN UNNEST(db_tags)) AND (@p_1 IN UNNEST(db_scores)) AND (NOT (TRUE IN UNNEST(db_flags))))")
+			})
+			Convey("repeated element of the wrong type", func() {
+				filter, err := ParseFilter("scores:abc")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "argument for field scores")
+			})
+			Convey("repeated element with a function", func() {
+				filter, err := ParseFilter("tags:f(x)")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "argument for field tags: functions are not allowed on the RHS of has (:) operator")
+			})
+			Convey("ordering operator on repeated column", func() {
+				filter, err := ParseFilter("scores > 10")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "ordering comparator \">\" cannot be used on repeated field \"scores\"")
+			})
+			Convey("equals operator on repeated column", func() {
+				filter, err := ParseFilter("tags = urgent")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "only the has operator (:) can be used on repeated field \"tags\"")
+			})
+			Convey("JSON field operators", func() {
+				filter, err := ParseFilter(`spec.owner.team = "x" AND spec.replicas > 2 AND spec.name:web`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{Name: "p_0", Value: "owner"},
+					{Name: "p_1", Value: "team"},
+					{Name: "p_2", Value: "x"},
+					{Name: "p_3", Value: "replicas"},
+					{Name: "p_4", Value: int64(2)},
+					{Name: "p_5", Value: "name"},
+					{Name: "p_6", Value: "%web%"},
+				})
+				So(result, ShouldEqual, "((JSON_VALUE(db_spec[@p_0][@p_1]) = @p_2) AND (SAFE_CAST(JSON_VALUE(db_spec[@p_3]) AS INT64) > @p_4) AND (JSON_VALUE(db_spec[@p_5]) LIKE @p_6))")
+			})
+			Convey("JSON field presence", func() {
+				filter, err := ParseFilter("spec.owner:*")
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{{Name: "p_0", Value: "owner"}})
+				So(result, ShouldEqual, "(JSON_VALUE(db_spec[@p_0]) IS NOT NULL)")
+			})
+			Convey("JSON column without a field", func() {
+				filter, err := ParseFilter("spec = x")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "JSON columns must specify the field to search on")
+			})
+			Convey("JSON field of the wrong type", func() {
+				filter, err := ParseFilter("spec.replicas > many")
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "argument for field spec.replicas")
+			})
+			Convey("wildcards", func() {
+				filter, err := ParseFilter(`host = "*.example.com" AND host != "a_b*c*" AND host = "example.com" AND parent = "shelves/1/*"`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{Name: "p_0", Value: "%.example.com"},
+					{Name: "p_1", Value: "a\\_b%c%"},
+					{Name: "p_2", Value: "example.com"},
+					{Name: "p_3", Value: "shelves/1/%"},
+				})
+				So(result, ShouldEqual, "((db_host LIKE @p_0) AND (NOT db_host LIKE @p_1) AND (db_host = @p_2) AND (db_parent LIKE @p_3))")
+			})
+			Convey("wildcards are literal without WithWildcards", func() {
+				filter, err := ParseFilter(`foo = "a*"`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{{Name: "p_0", Value: "a*"}})
+				So(result, ShouldEqual, "(db_foo = @p_0)")
+			})
+			Convey("non-trailing wildcard with prefix wildcards", func() {
+				filter, err := ParseFilter(`parent = "*/books"`)
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "argument for field parent: only a trailing wildcard (*) is allowed")
+			})
+			Convey("wildcards on a non-string column", func() {
+				_, err := NewTable().WithColumns(
+					NewColumn().WithFieldPath("id").WithDatabaseName("db_id").Int64().WithWildcards().Build(),
+				).TryBuild()
+				So(err, ShouldErrLike, "wildcards are only supported on string columns: id")
+			})
 			Convey("unsupported composite to LIKE", func() {
 				filter, err := ParseFilter("foo:(somevalue)")
 				So(err, ShouldEqual, nil)
@@ -257,6 +545,104 @@ func TestWhereClause(t *testing.T) {
 				So(result, ShouldEqual, "(EXISTS (SELECT key, value FROM UNNEST(db_quux) WHERE key = @p_0 AND value = @p_1))")
 			})
 		})
+		Convey("Functions", func() {
+			table := NewTable().WithColumns(
+				NewColumn().WithFieldPath("name").WithDatabaseName("db_name").Filterable().Build(),
+				NewColumn().WithFieldPath("create_time").WithDatabaseName("db_create_time").Timestamp().Filterable().Build(),
+				NewColumn().WithFieldPath("unfilterable").WithDatabaseName("unfilterable").Build(),
+			).WithFunction("startsWith", func(call *FunctionCall) (string, error) {
+				column, err := call.Column(0)
+				if err != nil {
+					return "", err
+				}
+				prefix, err := call.Literal(1)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%s LIKE %s", column, call.Bind(QuoteLike(prefix)+"%")), nil
+			}).WithFunction("time.ago", func(call *FunctionCall) (string, error) {
+				seconds, err := call.Literal(0)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL %s SECOND)", call.Bind(seconds)), nil
+			}).Build()
+
+			Convey("function as restriction", func() {
+				filter, err := ParseFilter(`startsWith(name, "a_b")`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: "a\\_b%",
+					},
+				})
+				So(result, ShouldEqual, "(db_name LIKE @p_0)")
+			})
+			Convey("function as argument", func() {
+				filter, err := ParseFilter(`create_time > time.ago(3600)`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: "3600",
+					},
+				})
+				So(result, ShouldEqual, "(db_create_time > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @p_0 SECOND))")
+			})
+			Convey("function compared to a value", func() {
+				filter, err := ParseFilter(`time.ago(60) <= "2024-01-01T00:00:00Z"`)
+				So(err, ShouldEqual, nil)
+
+				result, pars, err := table.WhereClause(filter, "p_")
+				So(err, ShouldBeNil)
+				So(pars, ShouldResemble, []QueryParameter{
+					{
+						Name:  "p_0",
+						Value: "60",
+					},
+					{
+						Name:  "p_1",
+						Value: "2024-01-01T00:00:00Z",
+					},
+				})
+				So(result, ShouldEqual, "(TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @p_0 SECOND) <= @p_1)")
+			})
+			Convey("unknown function", func() {
+				filter, err := ParseFilter(`endsWith(name, "x")`)
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "no function named \"endsWith\", valid functions are startsWith, time.ago")
+			})
+			Convey("unfilterable column argument", func() {
+				filter, err := ParseFilter(`startsWith(unfilterable, "x")`)
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "function startsWith: no filterable field \"unfilterable\"")
+			})
+			Convey("missing argument", func() {
+				filter, err := ParseFilter(`startsWith(name)`)
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "function startsWith expects at least 2 arguments, got 1")
+			})
+			Convey("function on RHS of has", func() {
+				filter, err := ParseFilter(`name:time.ago(1)`)
+				So(err, ShouldEqual, nil)
+
+				_, _, err = table.WhereClause(filter, "p_")
+				So(err, ShouldErrLike, "functions are not allowed on the RHS of has (:) operator")
+			})
+		})
 		Convey("Complex filter", func() {
 			filter, err := ParseFilter("implicit (foo=explicitone) OR -bar=explicittwo AND foo!=explicitthree OR baz:explicitfour")
 			So(err, ShouldEqual, nil)
@@ -289,3 +675,25 @@ func TestWhereClause(t *testing.T) {
 		})
 	})
 }
+
+func TestQueryParameterArgs(t *testing.T) {
+	Convey("QueryParameter args", t, func() {
+		pars := []QueryParameter{
+			{Name: "p_0", Value: "somevalue"},
+			{Name: "p_1", Value: int64(3)},
+		}
+		Convey("NamedArgs", func() {
+			So(NamedArgs(pars), ShouldResemble, []any{
+				sql.Named("p_0", "somevalue"),
+				sql.Named("p_1", int64(3)),
+			})
+		})
+		Convey("PositionalArgs", func() {
+			So(PositionalArgs(pars), ShouldResemble, []any{"somevalue", int64(3)})
+		})
+		Convey("Empty", func() {
+			So(NamedArgs(nil), ShouldHaveLength, 0)
+			So(PositionalArgs(nil), ShouldHaveLength, 0)
+		})
+	})
+}
@@ -0,0 +1,275 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// literalValue returns the Go value of the literal comparable on the right
+// hand side of a restriction on the given column. The type of the value
+// depends on the column type, as documented on QueryParameter.Value.
+func literalValue(comparable *Comparable, column *Column) (any, error) {
+	if comparable.Member == nil {
+		return nil, fmt.Errorf("invalid comparable")
+	}
+	switch column.columnType {
+	case ColumnTypeString:
+		if len(comparable.Member.Fields) > 0 {
+			return nil, fmt.Errorf("fields not implemented yet")
+		}
+		value := comparable.Member.Value
+		if column.argSubstitute != nil {
+			value = column.argSubstitute(value)
+		}
+		return value, nil
+	case ColumnTypeBool:
+		if len(comparable.Member.Fields) > 0 {
+			return nil, fmt.Errorf("fields not implemented yet")
+		}
+		if strings.EqualFold(comparable.Member.Value, "true") {
+			return true, nil
+		} else if strings.EqualFold(comparable.Member.Value, "false") {
+			return false, nil
+		}
+		return nil, fmt.Errorf("only TRUE or FALSE can be specified as the value for a boolean field")
+	case ColumnTypeInt64, ColumnTypeFloat64, ColumnTypeTimestamp, ColumnTypeDuration:
+		return parseLiteral(column.columnType, memberText(comparable.Member))
+	}
+	return nil, fmt.Errorf("unable to generate SQL value for unknown field type: %s", column.columnType.String())
+}
+
+// likeArgText returns the text searched for by the has (:) operator
+// with the given argument on the given column.
+func likeArgText(arg *Arg, column *Column) (string, error) {
+	if arg.Composite != nil {
+		return "", fmt.Errorf("composite expressions are not allowed as RHS to has (:) operator")
+	}
+	if arg.Comparable == nil {
+		return "", fmt.Errorf("missing comparable in argument")
+	}
+	if column.columnType != ColumnTypeString {
+		return "", fmt.Errorf("cannot use has (:) operator on a non-string field %q", column.columnType.String())
+	}
+	if column.argSubstitute != nil {
+		return "", fmt.Errorf("cannot use has (:) operator on a field that have argSubstitute function")
+	}
+	return likeComparableText(arg.Comparable)
+}
+
+// likeComparableText returns the text searched for by the has (:)
+// operator or an implicit restriction with the given comparable.
+func likeComparableText(comparable *Comparable) (string, error) {
+	if comparable.Function != nil {
+		return "", fmt.Errorf("functions are not allowed on the RHS of has (:) operator")
+	}
+	if comparable.Member == nil {
+		return "", fmt.Errorf("invalid comparable")
+	}
+	if len(comparable.Member.Fields) > 0 {
+		return "", fmt.Errorf("fields are not allowed on the RHS of has (:) operator")
+	}
+	return comparable.Member.Value, nil
+}
+
+// hasKeyText returns the key whose presence is tested by a has (:)
+// restriction on a key value column, e.g. "env" for `tags:env`.
+func hasKeyText(arg *Arg) (string, error) {
+	if arg.Composite != nil {
+		return "", fmt.Errorf("composite expressions are not allowed as RHS to has (:) operator")
+	}
+	if arg.Comparable == nil || arg.Comparable.Member == nil {
+		return "", fmt.Errorf("functions are not allowed on the RHS of has (:) operator")
+	}
+	return memberText(arg.Comparable.Member), nil
+}
+
+// elementComparable returns the element searched for by a has (:)
+// restriction on a repeated column, e.g. 42 for `scores:42`.
+func elementComparable(arg *Arg) (*Comparable, error) {
+	if arg.Composite != nil {
+		return nil, fmt.Errorf("composite expressions are not allowed as RHS to has (:) operator")
+	}
+	if arg.Comparable == nil || arg.Comparable.Member == nil {
+		return nil, fmt.Errorf("functions are not allowed on the RHS of has (:) operator")
+	}
+	return arg.Comparable, nil
+}
+
+// wildcardText returns the text of the argument of a = or != restriction
+// on a column with wildcards, and whether it contains a * wildcard.
+func wildcardText(arg *Arg, column *Column) (string, bool, error) {
+	if column.wildcards == noWildcards || arg.Comparable == nil || arg.Comparable.Member == nil {
+		return "", false, nil
+	}
+	value, err := literalValue(arg.Comparable, column)
+	if err != nil {
+		return "", false, err
+	}
+	text, ok := value.(string)
+	if !ok || !strings.Contains(text, "*") {
+		return "", false, nil
+	}
+	if column.wildcards == prefixWildcards && strings.IndexByte(text, '*') != len(text)-1 {
+		return "", false, fmt.Errorf("only a trailing wildcard (*) is allowed, e.g. \"prefix*\"")
+	}
+	return text, true, nil
+}
+
+// wildcardLike returns the LIKE pattern equivalent to text with *
+// wildcards, e.g. `%.example.com` for `*.example.com`.
+func wildcardLike(text string) string {
+	parts := strings.Split(text, "*")
+	for i, part := range parts {
+		parts[i] = QuoteLike(part)
+	}
+	return strings.Join(parts, "%")
+}
+
+// wildcardMatch reports whether s matches text with * wildcards.
+func wildcardMatch(text, s string) bool {
+	parts := strings.Split(text, "*")
+	if len(parts) == 1 {
+		return text == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
+
+// isWildcardArg reports whether the arg of a has (:) restriction is the
+// * wildcard, e.g. `tags.env:*`, which tests for the presence of a field
+// or key rather than searching its value.
+func isWildcardArg(arg *Arg) bool {
+	return arg.Comparable != nil && arg.Comparable.Member != nil &&
+		arg.Comparable.Member.Value == "*" && len(arg.Comparable.Member.Fields) == 0
+}
+
+// memberText returns the literal text of a member, rejoining any fields
+// with the traversal operator. The lexer splits numeric literals such
+// as 2.5 or 1.5s on the '.', so they appear as a member with fields.
+func memberText(member *Member) string {
+	if len(member.Fields) == 0 {
+		return member.Value
+	}
+	return member.Value + "." + strings.Join(member.Fields, ".")
+}
+
+// parseLiteral parses an AIP-160 literal into a Go value of the
+// given column type:
+//   - ColumnTypeString accepts any text and yields it as a string.
+//   - ColumnTypeBool accepts true or false, case-insensitively, and yields a bool.
+//   - ColumnTypeInt64 accepts decimal integers, e.g. 42, and yields an int64.
+//   - ColumnTypeFloat64 accepts decimal numbers, e.g. 2.5 or 1e3, and yields a float64.
+//   - ColumnTypeTimestamp accepts RFC 3339 timestamps, e.g. "2012-04-21T11:30:00-04:00",
+//     and yields a time.Time.
+//   - ColumnTypeDuration accepts seconds with an 's' suffix, e.g. 20s or 1.2s,
+//     and yields a time.Duration.
+func parseLiteral(columnType ColumnType, text string) (any, error) {
+	switch columnType {
+	case ColumnTypeString:
+		return text, nil
+	case ColumnTypeBool:
+		if strings.EqualFold(text, "true") {
+			return true, nil
+		} else if strings.EqualFold(text, "false") {
+			return false, nil
+		}
+		return nil, fmt.Errorf("expected true or false but got %q", text)
+	case ColumnTypeInt64:
+		v, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer value but got %q", text)
+		}
+		return v, nil
+	case ColumnTypeFloat64:
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("expected a numeric value but got %q", text)
+		}
+		return v, nil
+	case ColumnTypeTimestamp:
+		v, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, fmt.Errorf("expected an RFC 3339 timestamp (e.g. \"2012-04-21T11:30:00-04:00\") but got %q", text)
+		}
+		return v, nil
+	case ColumnTypeDuration:
+		seconds, ok := strings.CutSuffix(text, "s")
+		if ok {
+			_, err := strconv.ParseFloat(seconds, 64)
+			ok = err == nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("expected a duration in seconds (e.g. 20s or 1.2s) but got %q", text)
+		}
+		v, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", text, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unable to parse literal for field type: %s", columnType.String())
+}
+
+// formatLiteral formats a Go value of the given column type, as returned
+// by literalValue, into literal text that parses back to the same value.
+func formatLiteral(columnType ColumnType, value any) (string, error) {
+	switch x := value.(type) {
+	case string:
+		if columnType == ColumnTypeString {
+			return x, nil
+		}
+	case bool:
+		if columnType == ColumnTypeBool {
+			return strconv.FormatBool(x), nil
+		}
+	case int64:
+		if columnType == ColumnTypeInt64 {
+			return strconv.FormatInt(x, 10), nil
+		}
+	case float64:
+		if columnType == ColumnTypeFloat64 {
+			return strconv.FormatFloat(x, 'g', -1, 64), nil
+		}
+	case time.Time:
+		if columnType == ColumnTypeTimestamp {
+			return x.Format(time.RFC3339Nano), nil
+		}
+	case time.Duration:
+		if columnType == ColumnTypeDuration {
+			sign, d := "", uint64(x)
+			if x < 0 {
+				sign, d = "-", -d
+			}
+			return fmt.Sprintf("%s%d.%09ds", sign, d/uint64(time.Second), d%uint64(time.Second)), nil
+		}
+	}
+	return "", fmt.Errorf("cannot format %T as a literal of type %s", value, columnType.String())
+}
@@ -19,7 +19,6 @@ package aip
 
 // This file contains a lexer and parser for AIP-160 filter expressions.
 // The EBNF is at https://google.aip.dev/assets/misc/ebnf-filtering.txt
-// The function call syntax is not supported which simplifies the parser.
 //
 // Implemented EBNF (in terms of lexer tokens):
 // filter: [expression];
@@ -29,16 +28,24 @@ package aip
 // term: [NEGATE] simple;
 // simple: restriction | composite;
 // restriction: comparable [COMPARATOR arg];
-// comparable: member;
+// comparable: member | function;
 // member: (TEXT | STRING) {DOT TEXT};
+// function: TEXT {DOT TEXT} LPAREN [argList] RPAREN;
+// argList: arg {COMMA arg};
 // composite: LPAREN expression RPAREN;
 // arg: comparable | composite;
 //
+// The LPAREN of a function call must immediately follow the function
+// name, as "name (expression)" is a sequence of a member and a composite.
+//
+// A '-' immediately followed by a digit is lexed as the start of a TEXT
+// token rather than as NEGATE when it follows a COMPARATOR, so that
+// negative numbers such as "a > -3" can be compared against.
+//
 // TODO(mwarton): Redo whitespace handling.  There are still some cases (like "- 30")
 // 				  which are accepted as valid instead of being rejected.
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
@@ -57,22 +64,48 @@ const (
 	kindEnd        = "END"
 )
 
-// lexerRegexp has one group for each kind of token that can be lexed, in the order of the kind consts above. There are two cases for kindNegate to handle whitespace correctly.
-// nolint: lll
-var lexerRegexp = regexp.MustCompile(`^(<=|>=|!=|<|>|=|\:)|(NOT\s)|(-)|(AND\s)|(OR\s)|(\.)|(\()|(\))|(,)|("(?:[^"\\]|\\.)*")|([^\s\.,<>=!:\(\)]+)`)
-
 type token struct {
 	kind  string
 	value string
+	// Whether the token is preceded by whitespace.
+	spaceBefore bool
+	// The position of the start of the token in the filter.
+	pos position
+}
+
+// position is a position in a filter.
+type position struct {
+	// The byte offset, starting at 0.
+	offset int
+	// The line and column (in runes), starting at 1.
+	line, column int
 }
 
 type filterLexer struct {
 	input string
 	next  *token
+	// The position of the start of input.
+	pos position
+	// The kind of the last lexed token.
+	prev string
 }
 
 func NewLexer(input string) *filterLexer {
-	return &filterLexer{input: input}
+	return &filterLexer{input: input, pos: position{line: 1, column: 1}}
+}
+
+// advance consumes the first n bytes of the input.
+func (l *filterLexer) advance(n int) {
+	for _, r := range l.input[:n] {
+		if r == '\n' {
+			l.pos.line++
+			l.pos.column = 1
+		} else {
+			l.pos.column++
+		}
+	}
+	l.pos.offset += n
+	l.input = l.input[n:]
 }
 
 func (l *filterLexer) Peek() (*token, error) {
@@ -93,66 +126,167 @@ func (l *filterLexer) Next() (*token, error) {
 		return next, nil
 	}
 	l.next = nil
-	l.input = strings.TrimLeft(l.input, " \t\r\n")
-	if l.input == "" {
-		return &token{kind: kindEnd}, nil
-	}
-	matches := lexerRegexp.FindStringSubmatch(l.input)
-	if matches == nil {
-		return nil, fmt.Errorf("error: unable to lex token from %q", l.input)
-	}
-	l.input = l.input[len(matches[0]):]
-	if matches[1] != "" {
-		return &token{kind: kindComparator, value: matches[1]}, nil
-	}
-	if matches[2] != "" {
-		// Needs to be fixed up to compensate for the trailing \s in the match which prevents
-		// matching "NOTother" as a negated "other".
-		length := len(matches[2])
-		return &token{kind: kindNegate, value: matches[2][:length-1]}, nil
-	}
-	if matches[3] != "" {
-		return &token{kind: kindNegate, value: matches[3]}, nil
-	}
-	if matches[4] != "" {
-		// Needs to be fixed up to compensate for the trailing \s in the match which prevents
-		// matching "ANDother" as a "AND" "other".
-		length := len(matches[4])
-		return &token{kind: kindAnd, value: matches[4][:length-1]}, nil
-	}
-	if matches[5] != "" {
-		// Needs to be fixed up to compensate for the trailing \s in the match which prevents
-		// matching "ORother" as a "OR" "other".
-		length := len(matches[5])
-		return &token{kind: kindOr, value: matches[5][:length-1]}, nil
+	// Unlike the whitespace following keywords, \f does not separate tokens.
+	spaces := 0
+	for spaces < len(l.input) && strings.IndexByte(" \t\r\n", l.input[spaces]) >= 0 {
+		spaces++
+	}
+	l.advance(spaces)
+	pos := l.pos
+	t, err := l.lex()
+	if err != nil {
+		return nil, err
 	}
-	if matches[6] != "" {
-		return &token{kind: kindDot, value: matches[6]}, nil
+	t.spaceBefore = spaces > 0
+	t.pos = pos
+	l.prev = t.kind
+	return t, nil
+}
+
+// lex returns the token at the start of the (trimmed) input.
+//
+// The tokens are, in order of precedence:
+//
+//	COMPARATOR: <= >= != < > = :
+//	NEGATE:     "NOT" followed by whitespace, or - unless it starts a
+//	            negative number following a comparator, e.g. "a > -3"
+//	AND:        "AND" followed by whitespace
+//	OR:         "OR" followed by whitespace
+//	DOT, LPAREN, RPAREN, COMMA: . ( ) ,
+//	STRING:     "..." where \ escapes the next character, except a newline
+//	TEXT:       a run of bytes other than whitespace and .,<>=!:()
+//
+// The whitespace following NOT, AND and OR is part of the token, which
+// prevents matching "NOTother" as a negated "other". Whitespace is one of
+// \t \n \f \r and space.
+func (l *filterLexer) lex() (*token, error) {
+	input := l.input
+	if input == "" {
+		return &token{kind: kindEnd}, nil
 	}
-	if matches[7] != "" {
-		return &token{kind: kindLParen, value: matches[7]}, nil
+	kind, length := "", 1
+	switch input[0] {
+	case '<', '>':
+		kind = kindComparator
+		if len(input) > 1 && input[1] == '=' {
+			length = 2
+		}
+	case '!':
+		if len(input) > 1 && input[1] == '=' {
+			kind, length = kindComparator, 2
+		}
+	case '=', ':':
+		kind = kindComparator
+	case '-':
+		// A negative number is TEXT, as the argument of a comparator
+		// cannot be negated.
+		if l.prev != kindComparator || len(input) == 1 || input[1] < '0' || input[1] > '9' {
+			kind = kindNegate
+		}
+	case '.':
+		kind = kindDot
+	case '(':
+		kind = kindLParen
+	case ')':
+		kind = kindRParen
+	case ',':
+		kind = kindComma
+	case '"':
+		if n := stringLength(input); n > 0 {
+			kind, length = kindString, n
+		}
+	case 'N':
+		if keywordFollows(input, "NOT") {
+			return l.keyword(kindNegate, "NOT"), nil
+		}
+	case 'A':
+		if keywordFollows(input, "AND") {
+			return l.keyword(kindAnd, "AND"), nil
+		}
+	case 'O':
+		if keywordFollows(input, "OR") {
+			return l.keyword(kindOr, "OR"), nil
+		}
 	}
-	if matches[8] != "" {
-		return &token{kind: kindRParen, value: matches[8]}, nil
+	if kind == "" {
+		length = 0
+		for length < len(input) && isTextByte(input[length]) {
+			length++
+		}
+		if length == 0 {
+			found := input
+			if i := strings.IndexAny(found, " \t\r\n"); i >= 0 {
+				found = found[:i]
+			}
+			return nil, &FilterSyntaxError{
+				Offset:  l.pos.offset,
+				Line:    l.pos.line,
+				Column:  l.pos.column,
+				Found:   found,
+				Message: fmt.Sprintf("unable to lex token from %q", found),
+			}
+		}
+		kind = kindText
 	}
-	if matches[9] != "" {
-		return &token{kind: kindComma, value: matches[9]}, nil
+	l.advance(length)
+	return &token{kind: kind, value: input[:length]}, nil
+}
+
+// keyword consumes a keyword and the whitespace following it.
+func (l *filterLexer) keyword(kind, keyword string) *token {
+	l.advance(len(keyword) + 1)
+	return &token{kind: kind, value: keyword}
+}
+
+// keywordFollows reports whether the input starts with the keyword
+// followed by whitespace.
+func keywordFollows(input, keyword string) bool {
+	return len(input) > len(keyword) && strings.HasPrefix(input, keyword) && isFilterSpace(input[len(keyword)])
+}
+
+// stringLength returns the length of the STRING token at the start of the
+// input, or 0 if the string is not terminated.
+func stringLength(input string) int {
+	for i := 1; i < len(input); i++ {
+		switch input[i] {
+		case '"':
+			return i + 1
+		case '\\':
+			if i+1 == len(input) || input[i+1] == '\n' {
+				return 0
+			}
+			i++
+		}
 	}
-	if matches[10] != "" {
-		return &token{kind: kindString, value: matches[10]}, nil
+	return 0
+}
+
+// isFilterSpace reports whether c is whitespace, which may follow a
+// keyword and cannot be part of a TEXT token.
+func isFilterSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\f', '\r':
+		return true
 	}
-	if matches[11] != "" {
-		return &token{kind: kindText, value: matches[11]}, nil
+	return false
+}
+
+// isTextByte reports whether c may be part of a TEXT token.
+func isTextByte(c byte) bool {
+	switch c {
+	case '.', ',', '<', '>', '=', '!', ':', '(', ')':
+		return false
 	}
-	return nil, fmt.Errorf("error: unhandled lexer regexp match %q", matches[0])
+	return !isFilterSpace(c)
 }
 
 // AST Nodes.  These are based on the EBNF at https://google.aip.dev/assets/misc/ebnf-filtering.txt
-// Note that the syntax for functions is not currently supported.
 
 // Filter, possibly empty
 type Filter struct {
 	Expression *Expression // Optional, may be nil.
+	// The error recorded by the filter builder, see Err.
+	err error
 }
 
 func (v *Filter) String() string {
@@ -380,9 +514,11 @@ func (v *Arg) String() string {
 	return s.String()
 }
 
-// Comparable may either be a member or function.  As functions are not currently supported, it is always a member.
+// Comparable may either be a member or function.  Exactly one of Member and
+// Function is set.
 type Comparable struct {
-	Member *Member
+	Member   *Member
+	Function *Function
 }
 
 func (v *Comparable) String() string {
@@ -391,6 +527,45 @@ func (v *Comparable) String() string {
 	if v.Member != nil {
 		s.WriteString(v.Member.String())
 	}
+	if v.Function != nil {
+		s.WriteString(v.Function.String())
+	}
+	s.WriteString("}")
+	return s.String()
+}
+
+// Function calls may use simple or qualified names with zero or more
+// arguments.
+//
+// All functions declared within the list filter, apart from the special
+// `arguments` function must be provided by the host service.
+//
+// Examples:
+// * `regex(m.key, '^.*prod.*$')`
+// * `math.mem('30mb')`
+//
+// Antipattern: simple and qualified function names may include keywords:
+// NOT, AND, OR. It is not recommended that any of these names be used
+// within functions exposed by a service that supports list filters.
+type Function struct {
+	// Name is the unqualified name of the function, e.g. "mem".
+	Name string
+	// QualifiedName is the name of the function including its qualifiers,
+	// e.g. "math.mem". It equals Name for functions without qualifiers.
+	QualifiedName string
+	Args          []*Arg
+}
+
+func (v *Function) String() string {
+	var s strings.Builder
+	s.WriteString("function{")
+	s.WriteString(strconv.Quote(v.QualifiedName))
+	for _, c := range v.Args {
+		s.WriteString(",")
+		if c != nil {
+			s.WriteString(c.String())
+		}
+	}
 	s.WriteString("}")
 	return s.String()
 }
@@ -421,16 +596,70 @@ func (v *Member) String() string {
 }
 
 // ParseFilter parse an AIP-160 filter string into an AST.
+//
+// ParseFilter limits the filter to DefaultOptions, and returns a
+// *LimitExceededError if it exceeds them; use ParseFilterWithOptions
+// to parse filters with other limits.
 func ParseFilter(filter string) (*Filter, error) {
-	return newParser(filter).filter()
+	return ParseFilterWithOptions(filter, DefaultOptions)
+}
+
+// DefaultOptions are the limits applied by ParseFilter. They are generous
+// enough for any reasonable filter, but keep deeply nested filters from
+// exhausting the stack of the parser.
+var DefaultOptions = Options{
+	MaxDepth:  100,
+	MaxLength: 64 << 10,
+}
+
+// Options are limits on the filters accepted by ParseFilterWithOptions,
+// to protect services from filters which are expensive to parse or to
+// execute. A zero value means no limit.
+type Options struct {
+	// MaxDepth is the maximum nesting depth of parentheses, either
+	// composite expressions or function calls, e.g. 2 for `a AND (b OR f(c))`.
+	MaxDepth int
+	// MaxTerms is the maximum number of terms, not counting parenthesized
+	// expressions, e.g. 3 for `a AND (b OR -c)`.
+	MaxTerms int
+	// MaxLength is the maximum length of the filter in bytes.
+	MaxLength int
+}
+
+// ParseFilterWithOptions parses an AIP-160 filter string into an AST as
+// ParseFilter, and returns a *LimitExceededError if the filter exceeds one
+// of the limits of the options.
+func ParseFilterWithOptions(filter string, options Options) (*Filter, error) {
+	if options.MaxLength > 0 && len(filter) > options.MaxLength {
+		return nil, &LimitExceededError{Field: "filter", Limit: "MaxLength", Max: options.MaxLength}
+	}
+	return newParser(filter, options).filter()
 }
 
 type parser struct {
-	lexer filterLexer
+	lexer   filterLexer
+	options Options
+	// The current nesting depth and the number of parsed terms.
+	depth, terms int
 }
 
-func newParser(input string) *parser {
-	return &parser{lexer: *NewLexer(input)}
+func newParser(input string, options Options) *parser {
+	return &parser{lexer: *NewLexer(input), options: options}
+}
+
+// enter enters a composite expression or function call, checking the
+// nesting depth. It must be followed by a call of leave.
+func (p *parser) enter() error {
+	p.depth++
+	if p.options.MaxDepth > 0 && p.depth > p.options.MaxDepth {
+		return &LimitExceededError{Field: "filter", Limit: "MaxDepth", Max: p.options.MaxDepth}
+	}
+	return nil
+}
+
+// leave leaves a composite expression or function call.
+func (p *parser) leave() {
+	p.depth--
 }
 
 func (p *parser) expect(kind string) error {
@@ -439,12 +668,22 @@ func (p *parser) expect(kind string) error {
 		return err
 	}
 	if t.kind != kind {
-		return fmt.Errorf("expected %s but got %s(%q)", kind, t.kind, t.value)
+		return p.errorf([]string{kind}, "expected %s", kind)
 	}
 	_, err = p.lexer.Next()
 	return err
 }
 
+// errorf returns a syntax error at the next token, which is not one of the
+// expected kinds.
+func (p *parser) errorf(expected []string, format string, args ...any) error {
+	t, err := p.lexer.Peek()
+	if err != nil {
+		return err
+	}
+	return newFilterSyntaxError(t, expected, fmt.Sprintf(format, args...)+", got "+describeToken(t))
+}
+
 func (p *parser) accept(kind string) (*token, error) {
 	t, err := p.lexer.Peek()
 	if err != nil {
@@ -494,7 +733,7 @@ func (p *parser) expression() (*Expression, error) {
 			return nil, err
 		}
 		if s == nil {
-			return nil, fmt.Errorf("expected sequence after AND")
+			return nil, p.errorf(termKinds, "expected sequence after AND")
 		}
 		e.Sequences = append(e.Sequences, s)
 	}
@@ -542,7 +781,7 @@ func (p *parser) factor() (*Factor, error) {
 			return nil, err
 		}
 		if t == nil {
-			return nil, fmt.Errorf("expected sequence after AND")
+			return nil, p.errorf(termKinds, "expected term after OR")
 		}
 		f.Terms = append(f.Terms, t)
 	}
@@ -560,10 +799,16 @@ func (p *parser) term() (*Term, error) {
 	}
 	if s == nil {
 		if n != nil {
-			return nil, fmt.Errorf("expected simple term after negation %q", n.value)
+			return nil, p.errorf(simpleKinds, "expected simple term after negation %q", n.value)
 		}
 		return nil, nil
 	}
+	if s.Restriction != nil {
+		p.terms++
+	}
+	if p.options.MaxTerms > 0 && p.terms > p.options.MaxTerms {
+		return nil, &LimitExceededError{Field: "filter", Limit: "MaxTerms", Max: p.options.MaxTerms}
+	}
 	return &Term{Negated: n != nil, Simple: s}, nil
 }
 
@@ -605,12 +850,17 @@ func (p *parser) restriction() (*Restriction, error) {
 		return nil, err
 	}
 	if arg == nil {
-		return nil, fmt.Errorf("expected arg after %s", comparator.value)
+		return nil, p.errorf(simpleKinds, "expected arg after %s", comparator.value)
 	}
 	return &Restriction{Comparable: comparable, Comparator: comparator.value, Arg: arg}, nil
 }
 
 func (p *parser) comparable() (*Comparable, error) {
+	t, err := p.lexer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	isText := t.kind == kindText
 	m, err := p.member()
 	if err != nil {
 		return nil, err
@@ -618,7 +868,66 @@ func (p *parser) comparable() (*Comparable, error) {
 	if m == nil {
 		return nil, nil
 	}
-	return &Comparable{Member: m}, nil
+	if !isText {
+		return &Comparable{Member: m}, nil
+	}
+	lparen, err := p.lexer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if lparen.kind != kindLParen || lparen.spaceBefore {
+		return &Comparable{Member: m}, nil
+	}
+	f, err := p.function(m)
+	if err != nil {
+		return nil, err
+	}
+	return &Comparable{Function: f}, nil
+}
+
+// function parses the argument list of a call to the function with the
+// name given by the already parsed member.
+func (p *parser) function(name *Member) (*Function, error) {
+	if err := p.expect(kindLParen); err != nil {
+		return nil, err
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	f := &Function{
+		Name:          name.Value,
+		QualifiedName: name.Value,
+	}
+	if len(name.Fields) > 0 {
+		f.Name = name.Fields[len(name.Fields)-1]
+		f.QualifiedName = name.Value + "." + strings.Join(name.Fields, ".")
+	}
+	rparen, err := p.accept(kindRParen)
+	if err != nil {
+		return nil, err
+	}
+	if rparen != nil {
+		return f, nil
+	}
+	for {
+		arg, err := p.arg()
+		if err != nil {
+			return nil, err
+		}
+		if arg == nil {
+			return nil, p.errorf(simpleKinds, "expected argument to function %s", f.QualifiedName)
+		}
+		f.Args = append(f.Args, arg)
+		comma, err := p.accept(kindComma)
+		if err != nil {
+			return nil, err
+		}
+		if comma == nil {
+			break
+		}
+	}
+	return f, p.expect(kindRParen)
 }
 
 func (p *parser) member() (*Member, error) {
@@ -627,10 +936,11 @@ func (p *parser) member() (*Member, error) {
 		return nil, err
 	}
 	if v != nil {
-		v.value, err = strconv.Unquote(v.value)
+		value, err := strconv.Unquote(v.value)
 		if err != nil {
-			return nil, fmt.Errorf("error unquoting string: %w", err)
+			return nil, newFilterSyntaxError(v, nil, fmt.Sprintf("invalid string %s: %v", v.value, err))
 		}
+		v.value = value
 		return &Member{Value: v.value}, nil
 	}
 
@@ -655,7 +965,7 @@ func (p *parser) member() (*Member, error) {
 			return nil, err
 		}
 		if f == nil {
-			return nil, fmt.Errorf("expected field name after '.'")
+			return nil, p.errorf([]string{kindText}, "expected field name after '.'")
 		}
 		m.Fields = append(m.Fields, f.value)
 	}
@@ -670,12 +980,16 @@ func (p *parser) composite() (*Expression, error) {
 	if lparen == nil {
 		return nil, nil
 	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	e, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
 	if e == nil {
-		return nil, fmt.Errorf("expected expression")
+		return nil, p.errorf(termKinds, "expected expression")
 	}
 	return e, p.expect(kindRParen)
 }
@@ -14,7 +14,14 @@
 
 package aip
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
 
 func TestTokenKinds(t *testing.T) {
 	tests := []struct {
@@ -154,8 +161,27 @@ func TestFullParse(t *testing.T) {
 		{input: "member.field", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"member\", {\"field\"}}}}}}}}}}"},
 		{input: " member.field > 4 ", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"member\", {\"field\"}}},\">\",arg{comparable{member{\"4\"}}}}}}}}}}}"},
 		{input: "composite (expression)", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"composite\"}}}}}}},factor{term{simple{expression{sequence{factor{term{simple{restriction{comparable{member{\"expression\"}}}}}}}}}}}}}}}"},
-		// This should parse as a function, but function parsing is not implemented.
-		// {input: "function(expression)", ast: ""},
+		{input: "function(expression)", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{function{\"function\",arg{comparable{member{\"expression\"}}}}}}}}}}}}}"},
+		{input: "math.mem(\"30mb\")", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{function{\"math.mem\",arg{comparable{member{\"30mb\"}}}}}}}}}}}}}"},
+		{input: "now()", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{function{\"now\"}}}}}}}}}"},
+		{input: "f(a.b, (c))", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{function{\"f\",arg{comparable{member{\"a\", {\"b\"}}}},arg{expression{sequence{factor{term{simple{restriction{comparable{member{\"c\"}}}}}}}}}}}}}}}}}}}"},
+		{input: "time > ago(20s)", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"time\"}}},\">\",arg{comparable{function{\"ago\",arg{comparable{member{\"20s\"}}}}}}}}}}}}}}"},
+		// A - following a comparator starts a negative number rather than a negation.
+		{input: "i > -3", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"i\"}}},\">\",arg{comparable{member{\"-3\"}}}}}}}}}}}"},
+		{input: "f>-2.5", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"f\"}}},\">\",arg{comparable{member{\"-2\", {\"5\"}}}}}}}}}}}"},
+		{input: "-d > -20s", ast: "filter{expression{sequence{factor{term{-simple{restriction{comparable{member{\"d\"}}},\">\",arg{comparable{member{\"-20s\"}}}}}}}}}}}"},
+		{input: "a > -3", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"a\"}}},\">\",arg{comparable{member{\"-3\"}}}}}}}}}}}"},
+		{input: "a > -3.5", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"a\"}}},\">\",arg{comparable{member{\"-3\", {\"5\"}}}}}}}}}}}"},
+		{input: "a>-3 -b", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"a\"}}},\">\",arg{comparable{member{\"-3\"}}}}}}}},factor{term{-simple{restriction{comparable{member{\"b\"}}}}}}}}}}"},
+		// Only numbers directly following the '-' are negative numbers.
+		{input: "a = -b", expectErr: true},
+		{input: "a = - 3", expectErr: true},
+		{input: "a > - 3", expectErr: true},
+		// A space between the name and the parenthesis makes it a sequence rather than a function call.
+		{input: "f (x)", ast: "filter{expression{sequence{factor{term{simple{restriction{comparable{member{\"f\"}}}}}}},factor{term{simple{expression{sequence{factor{term{simple{restriction{comparable{member{\"x\"}}}}}}}}}}}}}}}"},
+		{input: "f(", expectErr: true},
+		{input: "f(a,)", expectErr: true},
+		{input: "f(a b)", expectErr: true},
 	}
 	for _, test := range tests {
 		t.Run(test.input, func(t *testing.T) {
@@ -176,3 +202,400 @@ func TestFullParse(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	l := NewLexer("a AND\n  é.b >= 1\n")
+	expected := []position{
+		{offset: 0, line: 1, column: 1},
+		{offset: 2, line: 1, column: 3},
+		{offset: 8, line: 2, column: 3},
+		{offset: 10, line: 2, column: 4},
+		{offset: 11, line: 2, column: 5},
+		{offset: 13, line: 2, column: 7},
+		{offset: 16, line: 2, column: 10},
+		{offset: 18, line: 3, column: 1},
+	}
+	for i, want := range expected {
+		token, err := l.Next()
+		if err != nil {
+			t.Fatalf("Error getting next token: %v", err)
+		}
+		if token.pos != want {
+			t.Errorf("wrong position for token %d (%s): got %+v, want %+v", i, token.value, token.pos, want)
+		}
+	}
+}
+
+func TestFilterSyntaxError(t *testing.T) {
+	tests := []struct {
+		input string
+		want  FilterSyntaxError
+	}{
+		{
+			input: "explicit AND ",
+			want: FilterSyntaxError{Offset: 13, Line: 1, Column: 14, Expected: termKinds,
+				Message: "expected sequence after AND, got END"},
+		},
+		{
+			input: "a OR\n)",
+			want: FilterSyntaxError{Offset: 5, Line: 2, Column: 1, Expected: termKinds, Found: ")",
+				Message: `expected term after OR, got RPAREN(")")`},
+		},
+		{
+			input: "f(a b)",
+			want: FilterSyntaxError{Offset: 4, Line: 1, Column: 5, Expected: []string{kindRParen}, Found: "b",
+				Message: `expected RPAREN, got TEXT("b")`},
+		},
+		{
+			input: "a = ",
+			want: FilterSyntaxError{Offset: 4, Line: 1, Column: 5, Expected: simpleKinds,
+				Message: "expected arg after =, got END"},
+		},
+		{
+			input: "a.(b)",
+			want: FilterSyntaxError{Offset: 2, Line: 1, Column: 3, Expected: []string{kindText}, Found: "(",
+				Message: `expected field name after '.', got LPAREN("(")`},
+		},
+		{
+			input: "a = !b",
+			want: FilterSyntaxError{Offset: 4, Line: 1, Column: 5, Found: "!b",
+				Message: `unable to lex token from "!b"`},
+		},
+		{
+			input: `a = "\x"`,
+			want: FilterSyntaxError{Offset: 4, Line: 1, Column: 5, Found: `"\x"`,
+				Message: `invalid string "\x": invalid syntax`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := ParseFilter(test.input)
+			var syntaxErr *FilterSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected a *FilterSyntaxError, got %v", err)
+			}
+			if !reflect.DeepEqual(*syntaxErr, test.want) {
+				t.Errorf("wrong error for input %q:\ngot  %+v\nwant %+v", test.input, *syntaxErr, test.want)
+			}
+		})
+	}
+
+	err := &FilterSyntaxError{Line: 2, Column: 3, Message: "expected RPAREN, got END"}
+	if got, want := err.Error(), "syntax error at line 2, column 3: expected RPAREN, got END"; got != want {
+		t.Errorf("wrong error message: got %q, want %q", got, want)
+	}
+	violation := err.FieldViolation()
+	if violation.GetField() != "filter" || violation.GetDescription() != err.Error() {
+		t.Errorf("wrong field violation: %v", violation)
+	}
+}
+
+func TestParseFilterWithOptions(t *testing.T) {
+	deep := strings.Repeat("(", 100000) + "a" + strings.Repeat(")", 100000)
+	tests := []struct {
+		input   string
+		options Options
+		// The exceeded limit, if any.
+		limit string
+	}{
+		{input: "a AND (b OR f(c))", options: Options{MaxDepth: 2, MaxTerms: 3, MaxLength: 17}},
+		{input: "a AND (b OR f(c))", options: Options{MaxDepth: 1}, limit: "MaxDepth"},
+		{input: "a AND (b OR f(c))", options: Options{MaxTerms: 2}, limit: "MaxTerms"},
+		{input: "a AND (b OR f(c))", options: Options{MaxLength: 16}, limit: "MaxLength"},
+		{input: "f(g(h(x)))", options: Options{MaxDepth: 2}, limit: "MaxDepth"},
+		{input: "(a) (b) (c) (d)", options: Options{MaxDepth: 1}},
+		{input: "a = (b OR c)", options: Options{MaxTerms: 2}, limit: "MaxTerms"},
+		{input: deep, options: Options{MaxDepth: 10}, limit: "MaxDepth"},
+		{input: deep, options: Options{MaxLength: 1000}, limit: "MaxLength"},
+		{input: "", options: Options{MaxDepth: 1, MaxTerms: 1, MaxLength: 1}},
+	}
+	for _, test := range tests {
+		name := test.input
+		if len(name) > 20 {
+			name = name[:20]
+		}
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseFilterWithOptions(test.input, test.options)
+			if test.limit == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var limitErr *LimitExceededError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected a *LimitExceededError, got %v", err)
+			}
+			if limitErr.Field != "filter" || limitErr.Limit != test.limit {
+				t.Errorf("wrong limit exceeded: got %s %s, want filter %s", limitErr.Field, limitErr.Limit, test.limit)
+			}
+		})
+	}
+
+	t.Run("ParseFilter default limits", func(t *testing.T) {
+		for input, limit := range map[string]string{
+			strings.Repeat("(", 1000) + "a" + strings.Repeat(")", 1000): "MaxDepth",
+			strings.Repeat("(", 6<<20):                                  "MaxLength",
+		} {
+			_, err := ParseFilter(input)
+			var limitErr *LimitExceededError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected a *LimitExceededError, got %v", err)
+			}
+			if limitErr.Limit != limit {
+				t.Errorf("wrong limit exceeded: got %s, want %s", limitErr.Limit, limit)
+			}
+		}
+		if _, err := ParseFilter(strings.Repeat("(", 100) + "a" + strings.Repeat(")", 100)); err != nil {
+			t.Errorf("unexpected error for a filter within the default limits: %v", err)
+		}
+	})
+
+	err := &LimitExceededError{Field: "filter", Limit: "MaxDepth", Max: 5}
+	if got, want := err.Error(), "filter exceeds the maximum nesting depth of 5"; got != want {
+		t.Errorf("wrong error message: got %q, want %q", got, want)
+	}
+	if violation := err.FieldViolation(); violation.GetField() != "filter" || violation.GetDescription() != err.Error() {
+		t.Errorf("wrong field violation: %v", violation)
+	}
+}
+
+// lexerRegexp is the regexp the lexer was originally based on, kept
+// unchanged as a reference to test the lexer against. It has one group for
+// each kind of token that can be lexed, in the order of the kind consts.
+// Only the first group is anchored, see TestLexerDifferences.
+// nolint: lll
+var lexerRegexp = regexp.MustCompile(`^(<=|>=|!=|<|>|=|\:)|(NOT\s)|(-)|(AND\s)|(OR\s)|(\.)|(\()|(\))|(,)|("(?:[^"\\]|\\.)*")|([^\s\.,<>=!:\(\)]+)`)
+
+// negativeNumberRegexp matches the start of a negative number.
+var negativeNumberRegexp = regexp.MustCompile(`^-[0-9]`)
+
+// regexpTokens lexes the input as the original lexer did with lexerRegexp,
+// up to the END token or an error. Errors are reported as the
+// *FilterSyntaxError the lexer returns.
+//
+// diverged is the index of the first token at which the lexer deliberately
+// differs from the original lexer, or -1:
+//   - the original lexer skipped bytes which could not be lexed when a
+//     later, unanchored group matched further in the input, e.g. "!" in
+//     "!a", while the lexer returns an error.
+//   - the original lexer lexed a negative number following a comparator
+//     as NEGATE and TEXT, e.g. "-3" in "a>-3", while the lexer returns a
+//     single TEXT token.
+func regexpTokens(input string) (tokens []token, diverged int, err error) {
+	kinds := []string{kindComparator, kindNegate, kindNegate, kindAnd, kindOr, kindDot, kindLParen, kindRParen, kindComma, kindString, kindText}
+	l := NewLexer(input)
+	diverged = -1
+	for {
+		spaces := len(l.input) - len(strings.TrimLeft(l.input, " \t\r\n"))
+		l.advance(spaces)
+		t := token{kind: kindEnd, spaceBefore: spaces > 0, pos: l.pos}
+		if l.input == "" {
+			return append(tokens, t), diverged, nil
+		}
+		if diverged < 0 && len(tokens) > 0 && tokens[len(tokens)-1].kind == kindComparator && negativeNumberRegexp.MatchString(l.input) {
+			diverged = len(tokens)
+		}
+		loc := lexerRegexp.FindStringSubmatchIndex(l.input)
+		if loc == nil {
+			found := l.input
+			if i := strings.IndexAny(found, " \t\r\n"); i >= 0 {
+				found = found[:i]
+			}
+			return tokens, diverged, &FilterSyntaxError{
+				Offset:  l.pos.offset,
+				Line:    l.pos.line,
+				Column:  l.pos.column,
+				Found:   found,
+				Message: fmt.Sprintf("unable to lex token from %q", found),
+			}
+		}
+		if diverged < 0 && loc[0] > 0 {
+			diverged = len(tokens)
+		}
+		for i, kind := range kinds {
+			if start := loc[2*i+2]; start >= 0 {
+				t.kind, t.value = kind, l.input[start:loc[2*i+3]]
+				break
+			}
+		}
+		// Like the original lexer, consume as many bytes as matched, even
+		// if the match does not start at the beginning of the input.
+		l.advance(loc[1] - loc[0])
+		if t.kind == kindNegate || t.kind == kindAnd || t.kind == kindOr {
+			// Strip the whitespace following keywords.
+			t.value = strings.TrimRight(t.value, " \t\n\f\r")
+		}
+		tokens = append(tokens, t)
+	}
+}
+
+// tokensText returns the kinds and values of tokens, e.g.
+// `TEXT("a") COMPARATOR("=")`.
+func tokensText(tokens []token) string {
+	var s []string
+	for _, t := range tokens {
+		s = append(s, describeToken(&t))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestLexerDifferences(t *testing.T) {
+	tests := []struct {
+		input string
+		// The tokens of the original lexer, and of the lexer up to its
+		// error, if any.
+		original, lexed string
+		err             string
+	}{
+		// Bytes which cannot be lexed are an error, instead of being
+		// skipped while the following token is lexed twice.
+		{
+			input:    "a !b",
+			original: `TEXT("a") TEXT("b") TEXT("b") END`,
+			lexed:    `TEXT("a")`,
+			err:      `unable to lex token from "!b"`,
+		},
+		{
+			input:    "a \f b",
+			original: `TEXT("a") TEXT("b") TEXT("b") END`,
+			lexed:    `TEXT("a")`,
+			err:      `unable to lex token from "\f"`,
+		},
+		// Negative numbers following a comparator are values.
+		{
+			input:    "a>-3",
+			original: `TEXT("a") COMPARATOR(">") NEGATE("-") TEXT("3") END`,
+			lexed:    `TEXT("a") COMPARATOR(">") TEXT("-3") END`,
+		},
+		{
+			input:    "a = -2.5",
+			original: `TEXT("a") COMPARATOR("=") NEGATE("-") TEXT("2") DOT(".") TEXT("5") END`,
+			lexed:    `TEXT("a") COMPARATOR("=") TEXT("-2") DOT(".") TEXT("5") END`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			original, diverged, err := regexpTokens(test.input)
+			if err != nil {
+				t.Fatalf("unexpected error of the original lexer: %s", err)
+			}
+			if diverged < 0 {
+				t.Errorf("the original lexer does not diverge")
+			}
+			if got := tokensText(original); got != test.original {
+				t.Errorf("wrong tokens of the original lexer:\ngot  %s\nwant %s", got, test.original)
+			}
+			lexed, err := lexTokens(test.input)
+			if got := tokensText(lexed); got != test.lexed {
+				t.Errorf("wrong tokens of the lexer:\ngot  %s\nwant %s", got, test.lexed)
+			}
+			if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("wrong error of the lexer: got %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+// lexTokens lexes the input with the lexer, up to the END token or an error.
+func lexTokens(input string) ([]token, error) {
+	l := NewLexer(input)
+	var tokens []token
+	for {
+		t, err := l.Next()
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, *t)
+		if t.kind == kindEnd {
+			return tokens, nil
+		}
+	}
+}
+
+var lexerTestInputs = []string{
+	"",
+	"a",
+	"text \"string with whitespace\" (43 AND 44) OR 45 NOT function(arg1, arg2):hello -field1.field2: hello field < 36",
+	"a<=1 b>=2 c!=3 d<4 e>5 f=6 g:7",
+	"NOT a NOTb NOT\tc NOT\nd NOT\fe NOT\vf NOT",
+	"a AND b ANDc AND\fd AND",
+	"a OR b ORc OR\re OR",
+	"\"escaped \\\" quote\" \"unterminated",
+	"\"escaped\\\nnewline\"",
+	"\"multi\nline\"",
+	"a = !b",
+	"a \f b",
+	"x\vy",
+	"- 30 -30 a-b",
+	"a>-3 b = -2.5 c<=-x d: -20s e=- 1 (f=-1)-2",
+	"\xff\xfe \"\\\xff\"",
+	"é.ü:\"日本\"",
+	"f(a.b, (c))",
+}
+
+func TestLexerMatchesRegexp(t *testing.T) {
+	for _, input := range lexerTestInputs {
+		t.Run(input, func(t *testing.T) {
+			checkLexerMatchesRegexp(t, input)
+		})
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	for _, input := range lexerTestInputs {
+		f.Add(input)
+	}
+	f.Fuzz(checkLexerMatchesRegexp)
+}
+
+// checkLexerMatchesRegexp checks the lexer yields the same tokens and
+// errors as the original lexer, up to their deliberate differences.
+func checkLexerMatchesRegexp(t *testing.T, input string) {
+	want, diverged, wantErr := regexpTokens(input)
+	got, err := lexTokens(input)
+	if diverged >= 0 {
+		// Only the tokens preceding the difference must match.
+		want, wantErr, err = append([]token(nil), want[:diverged]...), nil, nil
+		if len(got) > diverged {
+			got = append([]token(nil), got[:diverged]...)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong tokens for input %q:\ngot  %+v\nwant %+v", input, got, want)
+	}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("wrong error for input %q:\ngot  %v\nwant %v", input, err, wantErr)
+	}
+}
+
+// benchmarkFilter is a typical filter of a list request.
+const benchmarkFilter = `author.name = "John Doe" AND (create_time > "2024-01-02T03:04:05Z" OR NOT labels.env:prod) pages >= 100 -archived`
+
+func BenchmarkLexer(b *testing.B) {
+	b.Run("scanner", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := lexTokens(benchmarkFilter); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("regexp", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := regexpTokens(benchmarkFilter); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParseFilter(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseFilter(benchmarkFilter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+// This file provides the traversal of filter ASTs, to inspect filters
+// (e.g. to reject filters on sensitive fields) or transform them (e.g. to
+// rename deprecated fields) before generating SQL:
+//
+//	for _, path := range aip.ReferencedFieldPaths(filter) {
+//		if p := path.String(); p == "secret" || strings.HasPrefix(p, "secret.") {
+//			return status.Error(codes.InvalidArgument, "cannot filter by secret")
+//		}
+//	}
+//
+//	filter, err = aip.Rewrite(filter, aip.RewriterFunc(func(node aip.Node) (aip.Node, error) {
+//		// Only rename the field, not values or function arguments.
+//		if r, ok := node.(*aip.Restriction); ok && r.Comparable.Member != nil && r.Comparable.Member.Value == "old_name" {
+//			r.Comparable.Member.Value = "new_name"
+//		}
+//		return node, nil
+//	}))
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Node is a node of a filter AST: *Filter, *Expression, *Sequence,
+// *Factor, *Term, *Simple, *Restriction, *Arg, *Comparable, *Function or
+// *Member.
+type Node interface {
+	fmt.Stringer
+	filterNode()
+}
+
+func (*Filter) filterNode()      {}
+func (*Expression) filterNode()  {}
+func (*Sequence) filterNode()    {}
+func (*Factor) filterNode()      {}
+func (*Term) filterNode()        {}
+func (*Simple) filterNode()      {}
+func (*Restriction) filterNode() {}
+func (*Arg) filterNode()         {}
+func (*Comparable) filterNode()  {}
+func (*Function) filterNode()    {}
+func (*Member) filterNode()      {}
+
+// Visitor visits the nodes of a filter AST, see Walk.
+type Visitor interface {
+	// Visit is called for each node. If the returned visitor w is not nil,
+	// the children of the node are visited with w, followed by a call of
+	// w.Visit(nil).
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a filter AST in depth-first order, in the order the
+// nodes appear in the filter. It starts by calling v.Visit(node), see
+// Visitor. Nil children are not visited.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Filter:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+	case *Expression:
+		for _, sequence := range n.Sequences {
+			Walk(v, sequence)
+		}
+	case *Sequence:
+		for _, factor := range n.Factors {
+			Walk(v, factor)
+		}
+	case *Factor:
+		for _, term := range n.Terms {
+			Walk(v, term)
+		}
+	case *Term:
+		if n.Simple != nil {
+			Walk(v, n.Simple)
+		}
+	case *Simple:
+		if n.Restriction != nil {
+			Walk(v, n.Restriction)
+		}
+		if n.Composite != nil {
+			Walk(v, n.Composite)
+		}
+	case *Restriction:
+		if n.Comparable != nil {
+			Walk(v, n.Comparable)
+		}
+		if n.Arg != nil {
+			Walk(v, n.Arg)
+		}
+	case *Arg:
+		if n.Comparable != nil {
+			Walk(v, n.Comparable)
+		}
+		if n.Composite != nil {
+			Walk(v, n.Composite)
+		}
+	case *Comparable:
+		if n.Member != nil {
+			Walk(v, n.Member)
+		}
+		if n.Function != nil {
+			Walk(v, n.Function)
+		}
+	case *Function:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	case *Member:
+	default:
+		panic(fmt.Sprintf("aip: unexpected node type %T", node))
+	}
+	v.Visit(nil)
+}
+
+// inspector is the Visitor of Inspect.
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a filter AST in depth-first order, calling f(node) for
+// each node. If f returns true, Inspect also traverses the children of the
+// node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ReferencedFieldPaths returns the field paths referenced by the
+// restrictions of the filter, in the order they first appear, e.g.
+// "author.name" and "pages" for `author.name = "x" OR pages > 100`.
+//
+// The left-hand side of a restriction with a comparator is a field
+// reference, as are the member arguments of functions, e.g. "secret" for
+// `startsWith(secret, "a")`, since functions may resolve them to columns.
+// As the parser does not keep whether a member was quoted, literal
+// arguments such as "a" are reported too. Values of restrictions and
+// global restrictions such as `prod` are not included.
+func ReferencedFieldPaths(filter *Filter) []FieldPath {
+	if filter == nil {
+		return nil
+	}
+	var result []FieldPath
+	seen := make(map[string]struct{})
+	add := func(m *Member) {
+		path := NewFieldPath(append([]string{m.Value}, m.Fields...)...)
+		if _, ok := seen[path.String()]; !ok {
+			seen[path.String()] = struct{}{}
+			result = append(result, path)
+		}
+	}
+	Inspect(filter, func(node Node) bool {
+		switch n := node.(type) {
+		case *Restriction:
+			if n.Comparator != "" && n.Comparable != nil && n.Comparable.Member != nil {
+				add(n.Comparable.Member)
+			}
+		case *Function:
+			for _, arg := range n.Args {
+				if arg.Comparable != nil && arg.Comparable.Member != nil {
+					add(arg.Comparable.Member)
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// Rewriter rewrites the nodes of a filter AST, see Rewrite.
+type Rewriter interface {
+	// Rewrite returns the replacement of the node, which must be of the
+	// same type, or nil to remove it.
+	Rewrite(node Node) (Node, error)
+}
+
+// RewriterFunc adapts a function to a Rewriter.
+type RewriterFunc func(node Node) (Node, error)
+
+// Rewrite calls f(node).
+func (f RewriterFunc) Rewrite(node Node) (Node, error) {
+	return f(node)
+}
+
+// Rewrite returns a copy of the filter rewritten by r. The filter is not
+// modified.
+//
+// The nodes are rewritten bottom-up: the children of a node are rewritten
+// before the node itself, so r is given a copy of the node with its
+// rewritten children which it may modify in place and return.
+//
+// Returning nil removes a node. Elements of lists (sequences, factors,
+// terms and function arguments) are removed from their list, and removing
+// any other node, or every element of a list, removes its parent. A
+// negated term is removed whole if any node below it is removed, as e.g.
+// removing b from `NOT (a AND b)` would otherwise narrow it to `NOT a`.
+// Thus removing the restrictions which cannot be handled by a backend
+// widens the filter to the restrictions it can handle, so that the
+// backend returns a superset of the matching resources.
+// Removing every node yields an empty filter. The error recorded by the
+// filter builder, if any, is returned.
+func Rewrite(filter *Filter, r Rewriter) (*Filter, error) {
+	if err := filter.Err(); err != nil {
+		return nil, err
+	}
+	w := &rewriter{r: r}
+	result := &Filter{}
+	if filter != nil && filter.Expression != nil {
+		var err error
+		if result.Expression, err = w.expression(filter.Expression); err != nil {
+			return nil, err
+		}
+	}
+	result, err := rewriteNode(w, result)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return &Filter{}, nil
+	}
+	return result, nil
+}
+
+// rewriteNode rewrites a node with w.r, checking the type of the result.
+func rewriteNode[T Node](w *rewriter, node T) (T, error) {
+	var zero T
+	result, err := w.r.Rewrite(node)
+	if err != nil {
+		return zero, err
+	}
+	if result == nil {
+		w.removed++
+		return zero, nil
+	}
+	typed, ok := result.(T)
+	if !ok {
+		return zero, fmt.Errorf("rewriter returned %T for %T", result, node)
+	}
+	return typed, nil
+}
+
+// rewriter copies filter ASTs, rewriting their nodes. Each method returns
+// nil if the node is removed.
+type rewriter struct {
+	r Rewriter
+	// The number of nodes removed by r so far.
+	removed int
+}
+
+func (w *rewriter) expression(e *Expression) (*Expression, error) {
+	result := &Expression{}
+	for _, sequence := range e.Sequences {
+		s, err := w.sequence(sequence)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			result.Sequences = append(result.Sequences, s)
+		}
+	}
+	if len(result.Sequences) == 0 {
+		return nil, nil
+	}
+	return rewriteNode(w, result)
+}
+
+func (w *rewriter) sequence(s *Sequence) (*Sequence, error) {
+	result := &Sequence{}
+	for _, factor := range s.Factors {
+		f, err := w.factor(factor)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			result.Factors = append(result.Factors, f)
+		}
+	}
+	if len(result.Factors) == 0 {
+		return nil, nil
+	}
+	return rewriteNode(w, result)
+}
+
+func (w *rewriter) factor(f *Factor) (*Factor, error) {
+	result := &Factor{}
+	for _, term := range f.Terms {
+		t, err := w.term(term)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			result.Terms = append(result.Terms, t)
+		}
+	}
+	if len(result.Terms) == 0 {
+		return nil, nil
+	}
+	return rewriteNode(w, result)
+}
+
+func (w *rewriter) term(t *Term) (*Term, error) {
+	removed := w.removed
+	simple, err := w.simple(t.Simple)
+	if err != nil || simple == nil {
+		return nil, err
+	}
+	if t.Negated && w.removed > removed {
+		// Removing part of a negated term would narrow the filter.
+		return nil, nil
+	}
+	return rewriteNode(w, &Term{Negated: t.Negated, Simple: simple})
+}
+
+func (w *rewriter) simple(s *Simple) (*Simple, error) {
+	result := &Simple{}
+	var err error
+	switch {
+	case s.Restriction != nil:
+		result.Restriction, err = w.restriction(s.Restriction)
+	case s.Composite != nil:
+		result.Composite, err = w.expression(s.Composite)
+	}
+	if err != nil || (result.Restriction == nil && result.Composite == nil) {
+		return nil, err
+	}
+	return rewriteNode(w, result)
+}
+
+func (w *rewriter) restriction(r *Restriction) (*Restriction, error) {
+	comparable, err := w.comparable(r.Comparable)
+	if err != nil || comparable == nil {
+		return nil, err
+	}
+	result := &Restriction{Comparable: comparable, Comparator: r.Comparator}
+	if r.Arg != nil {
+		if result.Arg, err = w.arg(r.Arg); err != nil || result.Arg == nil {
+			return nil, err
+		}
+	}
+	return rewriteNode(w, result)
+}
+
+func (w *rewriter) arg(a *Arg) (*Arg, error) {
+	result := &Arg{}
+	var err error
+	switch {
+	case a.Comparable != nil:
+		result.Comparable, err = w.comparable(a.Comparable)
+	case a.Composite != nil:
+		result.Composite, err = w.expression(a.Composite)
+	}
+	if err != nil || (result.Comparable == nil && result.Composite == nil) {
+		return nil, err
+	}
+	return rewriteNode(w, result)
+}
+
+func (w *rewriter) comparable(c *Comparable) (*Comparable, error) {
+	result := &Comparable{}
+	var err error
+	switch {
+	case c.Member != nil:
+		result.Member, err = rewriteNode(w, &Member{Value: c.Member.Value, Fields: slices.Clone(c.Member.Fields)})
+	case c.Function != nil:
+		result.Function, err = w.function(c.Function)
+	}
+	if err != nil || (result.Member == nil && result.Function == nil) {
+		return nil, err
+	}
+	return rewriteNode(w, result)
+}
+
+func (w *rewriter) function(f *Function) (*Function, error) {
+	result := &Function{Name: f.Name, QualifiedName: f.QualifiedName}
+	for _, arg := range f.Args {
+		a, err := w.arg(arg)
+		if err != nil {
+			return nil, err
+		}
+		if a != nil {
+			result.Args = append(result.Args, a)
+		}
+	}
+	return rewriteNode(w, result)
+}
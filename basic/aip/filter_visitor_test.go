@@ -0,0 +1,178 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFilterVisitor(t *testing.T) {
+	Convey("Filter visitor", t, func() {
+		parse := func(filter string) *Filter {
+			f, err := ParseFilter(filter)
+			So(err, ShouldBeNil)
+			return f
+		}
+
+		Convey("Walk", func() {
+			var nodes []string
+			Inspect(parse(`a.b = 1 OR -f(c)`), func(node Node) bool {
+				if node == nil {
+					nodes = append(nodes, "end")
+				} else {
+					nodes = append(nodes, fmt.Sprintf("%T", node))
+				}
+				return true
+			})
+			So(nodes, ShouldResemble, []string{
+				"*aip.Filter", "*aip.Expression", "*aip.Sequence", "*aip.Factor",
+				"*aip.Term", "*aip.Simple", "*aip.Restriction",
+				"*aip.Comparable", "*aip.Member", "end", "end",
+				"*aip.Arg", "*aip.Comparable", "*aip.Member", "end", "end", "end",
+				"end", "end", "end",
+				"*aip.Term", "*aip.Simple", "*aip.Restriction", "*aip.Comparable", "*aip.Function",
+				"*aip.Arg", "*aip.Comparable", "*aip.Member", "end", "end", "end",
+				"end", "end", "end", "end", "end",
+				"end", "end", "end", "end",
+			})
+		})
+		Convey("Inspect skips children", func() {
+			count := 0
+			Inspect(parse(`a = 1 AND (b = 2 OR c = 3)`), func(node Node) bool {
+				if node != nil {
+					count++
+				}
+				_, isSimple := node.(*Simple)
+				return !isSimple
+			})
+			// The filter, its expression, and the sequence, factor, term and
+			// simple of each side of the AND.
+			So(count, ShouldEqual, 10)
+		})
+		Convey("ReferencedFieldPaths", func() {
+			paths := func(filter string) []string {
+				var result []string
+				for _, path := range ReferencedFieldPaths(parse(filter)) {
+					result = append(result, path.String())
+				}
+				return result
+			}
+			So(paths(`author.name = "x" OR pages > 100 prod AND (pages < 500 labels.env:prod) AND NOT f(g) = 1`), ShouldResemble, []string{"author.name", "pages", "labels.env", "g"})
+			// Functions may resolve their arguments to columns.
+			So(paths(`startsWith(secret, "a")`), ShouldResemble, []string{"secret", "a"})
+			So(paths(`a = f(b.c, g(d), (e = 1))`), ShouldResemble, []string{"a", "b.c", "d", "e"})
+			So(ReferencedFieldPaths(&Filter{}), ShouldBeEmpty)
+			So(ReferencedFieldPaths(nil), ShouldBeEmpty)
+		})
+		Convey("Rewrite", func() {
+			Convey("Rename fields", func() {
+				filter := parse(`old_name = old_name AND f(old_name) OR x.old_name:y`)
+				original := filter.String()
+				result, err := Rewrite(filter, RewriterFunc(func(node Node) (Node, error) {
+					if r, ok := node.(*Restriction); ok && r.Comparable.Member != nil && r.Comparable.Member.Value == "old_name" {
+						r.Comparable.Member.Value = "new_name"
+					}
+					return node, nil
+				}))
+				So(err, ShouldBeNil)
+				So(Format(result), ShouldEqual, `new_name = old_name AND f(old_name) OR x.old_name:y`)
+				So(filter.String(), ShouldEqual, original)
+			})
+			Convey("Remove restrictions", func() {
+				removeSecrets := RewriterFunc(func(node Node) (Node, error) {
+					if r, ok := node.(*Restriction); ok && r.Comparable.Member != nil && r.Comparable.Member.Value == "secret" {
+						return nil, nil
+					}
+					return node, nil
+				})
+				result, err := Rewrite(parse(`a = 1 AND secret = 2 AND (b = 3 OR NOT secret = 4)`), removeSecrets)
+				So(err, ShouldBeNil)
+				So(Format(result), ShouldEqual, `a = 1 AND b = 3`)
+
+				result, err = Rewrite(parse(`secret = 1 AND (secret = 2)`), removeSecrets)
+				So(err, ShouldBeNil)
+				So(result, ShouldResemble, &Filter{})
+
+				result, err = Rewrite(parse(`a = 1 AND f(secret)`), removeSecrets)
+				So(err, ShouldBeNil)
+				So(Format(result), ShouldEqual, `a = 1 AND f(secret)`)
+			})
+			Convey("Remove restrictions under negations", func() {
+				removeSecrets := RewriterFunc(func(node Node) (Node, error) {
+					if r, ok := node.(*Restriction); ok && r.Comparable.Member != nil && r.Comparable.Member.Value == "secret" {
+						return nil, nil
+					}
+					return node, nil
+				})
+				// NOT a = 1 would be narrower than the original filter.
+				result, err := Rewrite(parse(`c = 1 AND NOT (a = 1 AND secret = 2)`), removeSecrets)
+				So(err, ShouldBeNil)
+				So(Format(result), ShouldEqual, `c = 1`)
+
+				result, err = Rewrite(parse(`c = 1 AND NOT (a = 1 AND NOT (b = 1 OR secret = 2))`), removeSecrets)
+				So(err, ShouldBeNil)
+				So(Format(result), ShouldEqual, `c = 1`)
+
+				result, err = Rewrite(parse(`NOT (a = 1 AND b = 2) AND secret = 3`), removeSecrets)
+				So(err, ShouldBeNil)
+				So(Format(result), ShouldEqual, `NOT (a = 1 AND b = 2)`)
+			})
+			Convey("Replace nodes", func() {
+				result, err := Rewrite(parse(`a = 1 b = 2`), RewriterFunc(func(node Node) (Node, error) {
+					if t, ok := node.(*Term); ok {
+						t.Negated = !t.Negated
+					}
+					return node, nil
+				}))
+				So(err, ShouldBeNil)
+				So(Format(result), ShouldEqual, `NOT a = 1 NOT b = 2`)
+			})
+			Convey("Errors", func() {
+				_, err := Rewrite(parse(`secret = 1`), RewriterFunc(func(node Node) (Node, error) {
+					if m, ok := node.(*Member); ok && m.Value == "secret" {
+						return nil, fmt.Errorf("cannot filter by %s", m.Value)
+					}
+					return node, nil
+				}))
+				So(err, ShouldErrLike, "cannot filter by secret")
+
+				_, err = Rewrite(parse(`a = 1`), RewriterFunc(func(node Node) (Node, error) {
+					if _, ok := node.(*Member); ok {
+						return &Function{Name: "f", QualifiedName: "f"}, nil
+					}
+					return node, nil
+				}))
+				So(err, ShouldErrLike, "rewriter returned *aip.Function for *aip.Member")
+			})
+			Convey("Empty filter", func() {
+				result, err := Rewrite(&Filter{}, RewriterFunc(func(node Node) (Node, error) {
+					return node, nil
+				}))
+				So(err, ShouldBeNil)
+				So(result, ShouldResemble, &Filter{})
+			})
+			Convey("Invalid builder values", func() {
+				_, err := Rewrite(And(Eq("a", "1"), Eq("b", nil)), RewriterFunc(func(node Node) (Node, error) {
+					return node, nil
+				}))
+				So(err, ShouldErrLike, "invalid value of b")
+			})
+		})
+	})
+}
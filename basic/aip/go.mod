@@ -7,6 +7,8 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/smarty/assertions v1.16.0
 	github.com/smartystreets/goconvey v1.8.1
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19
+	google.golang.org/protobuf v1.36.6
 )
 
 require (
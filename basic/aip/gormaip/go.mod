@@ -0,0 +1,24 @@
+module github.com/imkuqin-zw/pkg/basic/aip/gormaip
+
+go 1.23.9
+
+require (
+	github.com/imkuqin-zw/pkg/basic/aip v0.0.0-00010101000000-000000000000
+	github.com/pkg/errors v0.9.1
+	github.com/smartystreets/goconvey v1.8.1
+	gorm.io/gorm v1.30.0
+)
+
+require (
+	github.com/alecthomas/participle/v2 v2.1.4 // indirect
+	github.com/gopherjs/gopherjs v1.17.2 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/jtolds/gls v4.20.0+incompatible // indirect
+	github.com/smarty/assertions v1.16.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
+	google.golang.org/protobuf v1.36.6 // indirect
+)
+
+replace github.com/imkuqin-zw/pkg/basic/aip => ../
@@ -0,0 +1,109 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gormaip applies AIP-160 filters and AIP-132 order_by clauses
+// to GORM queries.
+//
+// Example:
+//
+//	err := db.Scopes(gormaip.Scope(table, req.GetFilter(), req.GetOrderBy())).Find(&rows).Error
+package gormaip
+
+import (
+	"github.com/imkuqin-zw/pkg/basic/aip"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Scope returns a GORM scope that restricts the query to the rows matching
+// the AIP-160 filter and orders them by the AIP-132 order_by list.
+// Empty filter and order_by strings are ignored.
+//
+// Invalid filters or order_by lists are added to the errors of the
+// returned *gorm.DB.
+func Scope(table *aip.Table, filter, orderBy string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(Filter(table, filter), OrderBy(table, orderBy))
+	}
+}
+
+// Filter returns a GORM scope that restricts the query to the rows matching
+// the AIP-160 filter. Only filterable columns of the table may be referenced,
+// and the filter may not exceed aip.DefaultOptions.
+func Filter(table *aip.Table, filter string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		f, err := aip.ParseFilter(filter)
+		if err != nil {
+			return addError(db, errors.WithMessage(err, "filter"))
+		}
+		return db.Scopes(ParsedFilter(table, f))
+	}
+}
+
+// ParsedFilter returns a GORM scope that restricts the query to the rows
+// matching the parsed AIP-160 filter.
+func ParsedFilter(table *aip.Table, filter *aip.Filter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.Expression == nil {
+			return db
+		}
+		clause, params, err := table.WithDialect(gormDialect{table.Dialect()}).WhereClause(filter, "")
+		if err != nil {
+			return addError(db, errors.WithMessage(err, "filter"))
+		}
+		return db.Where(clause, aip.PositionalArgs(params)...)
+	}
+}
+
+// OrderBy returns a GORM scope that orders the query by the AIP-132
+// order_by list, followed by the optional default order for fields
+// not specified in the list. Only sortable columns of the table may be
+// referenced.
+func OrderBy(table *aip.Table, orderBy string, defaultOrder ...aip.OrderBy) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		order, err := aip.ParseOrderBy(orderBy)
+		if err != nil {
+			return addError(db, errors.WithMessage(err, "order_by"))
+		}
+		order = aip.MergeWithDefaultOrder(defaultOrder, order)
+		clause, err := table.OrderByClause(order)
+		if err != nil {
+			return addError(db, errors.WithMessage(err, "order_by"))
+		}
+		if clause == "" {
+			return db
+		}
+		return db.Order(clause)
+	}
+}
+
+func addError(db *gorm.DB, err error) *gorm.DB {
+	_ = db.AddError(err)
+	return db
+}
+
+// gormDialect wraps the dialect of a table to use GORM's positional
+// placeholder. GORM rewrites it into the placeholder of the underlying
+// database and numbers parameters across all clauses of the statement.
+type gormDialect struct {
+	aip.Dialect
+}
+
+func (gormDialect) Placeholder(string, int) string {
+	return "?"
+}
+
+func (gormDialect) Positional() bool {
+	return true
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gormaip
+
+import (
+	"testing"
+
+	"github.com/imkuqin-zw/pkg/basic/aip"
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+type thing struct {
+	ID          int64
+	DisplayName string
+	Priority    int64
+	Labels      string
+}
+
+func TestScope(t *testing.T) {
+	Convey("Scope", t, func() {
+		db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+		So(err, ShouldBeNil)
+
+		table := aip.NewTable().WithColumns(
+			aip.NewColumn().WithFieldPath("display_name").WithDatabaseName("display_name").FilterableImplicitly().Sortable().Build(),
+			aip.NewColumn().WithFieldPath("description").WithDatabaseName("description").FilterableImplicitly().Build(),
+			aip.NewColumn().WithFieldPath("priority").WithDatabaseName("priority").Int64().Filterable().Sortable().Build(),
+			aip.NewColumn().WithFieldPath("labels").WithDatabaseName("labels").KeyValue().Filterable().Build(),
+		).WithDialect(aip.MySQL).Build()
+
+		find := func(scopes ...func(*gorm.DB) *gorm.DB) *gorm.Statement {
+			var rows []thing
+			return db.Scopes(scopes...).Where("id > ?", 7).Find(&rows).Statement
+		}
+
+		Convey("Filter and order by", func() {
+			stmt := find(Scope(table, "text priority >= 3 labels.env = prod", "priority desc, display_name"))
+			So(stmt.Error, ShouldBeNil)
+			So(stmt.SQL.String(), ShouldEqual, "SELECT * FROM `things` WHERE id > ? AND "+
+				"(((`display_name` LIKE ? OR `description` LIKE ?) AND (`priority` >= ?) AND "+
+				"(COALESCE(JSON_UNQUOTE(JSON_EXTRACT(`labels`, CONCAT('$.', JSON_QUOTE(?)))) = ?, FALSE)))) "+
+				"ORDER BY `priority` DESC, `display_name`")
+			So(stmt.Vars, ShouldResemble, []any{7, "%text%", "%text%", int64(3), "env", "prod"})
+		})
+		Convey("Parameters of other dialects are rewritten", func() {
+			stmt := find(Filter(table.WithDialect(aip.PostgreSQL), "text"))
+			So(stmt.Error, ShouldBeNil)
+			So(stmt.SQL.String(), ShouldEqual, "SELECT * FROM `things` WHERE id > ? AND "+
+				`(("display_name" LIKE ? OR "description" LIKE ?))`)
+			So(stmt.Vars, ShouldResemble, []any{7, "%text%", "%text%"})
+		})
+		Convey("Empty filter and order by", func() {
+			stmt := find(Scope(table, "", ""))
+			So(stmt.Error, ShouldBeNil)
+			So(stmt.SQL.String(), ShouldEqual, "SELECT * FROM `things` WHERE id > ?")
+		})
+		Convey("Default order", func() {
+			stmt := find(OrderBy(table, "display_name desc", aip.OrderBy{FieldPath: aip.NewFieldPath("priority")}))
+			So(stmt.Error, ShouldBeNil)
+			So(stmt.SQL.String(), ShouldEqual, "SELECT * FROM `things` WHERE id > ? ORDER BY `display_name` DESC, `priority`")
+		})
+		Convey("Invalid filter", func() {
+			stmt := find(Filter(table, "unknown = 1"))
+			So(stmt.Error, ShouldErrLike, "filter: no filterable field \"unknown\"")
+		})
+		Convey("Invalid order by", func() {
+			stmt := find(OrderBy(table, "labels"))
+			So(stmt.Error, ShouldErrLike, "order_by: no sortable field named \"labels\"")
+		})
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeysetClause creates a Standard SQL WHERE clause fragment selecting the
+// rows after the cursor in the given order, for keyset ("seek")
+// pagination. The cursor holds the values of the order fields in the last
+// row of the previous page, keyed by field path (see Paginator).
+//
+// The tie-breaker column of the table (see TableBuilder.WithTieBreaker)
+// is appended to the order unless it already appears in it, so that rows
+// with equal values in the ordered columns are neither skipped nor
+// repeated. The cursor must hold its value too. For example, the order
+// "a, b desc" with the tie-breaker "id" yields:
+//
+//	((a > @k_0) OR (a = @k_0 AND (b < @k_1 OR b IS NULL)) OR (a = @k_0 AND b = @k_1 AND id > @k_2))
+//
+// The query must be ordered by the same order, as generated by
+// OrderByClause.
+//
+// The fragment is enclosed in parentheses and does not include the
+// "WHERE" keyword. An empty cursor, e.g. for the first page, yields
+// "(TRUE)". Placeholders, quoting and the returned parameters follow the
+// conventions of WhereClause. To combine the fragment with the WHERE
+// clause of the filter, use distinct parameter prefixes and, for dialects
+// numbering their placeholders, offset its parameters by those of the
+// filter with WithParameterOffset.
+//
+// Every field of the order must be a sortable column. Cursor values may
+// be nil for NULLs, which sort first in ascending order and last in
+// descending order, as in OrderByClause.
+func (t *Table) KeysetClause(order []OrderBy, cursor map[string]any, parameterPrefix string) (string, []QueryParameter, error) {
+	if len(cursor) == 0 {
+		return "(TRUE)", []QueryParameter{}, nil
+	}
+	columns, err := t.keysetColumns(order)
+	if err != nil {
+		return "", []QueryParameter{}, err
+	}
+	values := make([]any, 0, len(columns))
+	for _, k := range columns {
+		column := k.column
+		value, ok := cursor[column.fieldPath.String()]
+		if !ok {
+			return "", []QueryParameter{}, fmt.Errorf("cursor has no value for field %q", column.fieldPath.String())
+		}
+		value, err := cursorValue(column, value)
+		if err != nil {
+			return "", []QueryParameter{}, err
+		}
+		values = append(values, value)
+	}
+
+	w := &whereClause{
+		table:           t,
+		dialect:         t.Dialect(),
+		namePrefix:      parameterPrefix,
+		parameterOffset: t.parameterOffset,
+	}
+	// With named placeholders, each value is bound once and referenced by
+	// each clause. Positional parameters must be bound once per reference.
+	placeholders := make([]string, len(columns))
+	placeholder := func(i int) string {
+		if w.dialect.Positional() || placeholders[i] == "" {
+			placeholders[i] = w.literal(values[i])
+		}
+		return placeholders[i]
+	}
+	// equal returns the condition selecting the rows with the cursor value
+	// of column i.
+	equal := func(i int) string {
+		if values[i] == nil {
+			return w.columnName(columns[i].column) + " IS NULL"
+		}
+		return w.columnName(columns[i].column) + " = " + placeholder(i)
+	}
+	// after returns the condition selecting the rows after the cursor
+	// value of column i, which is not a NULL in descending order.
+	after := func(i int) string {
+		name := w.columnName(columns[i].column)
+		switch {
+		case values[i] == nil:
+			return name + " IS NOT NULL"
+		case columns[i].descending:
+			return "(" + name + " < " + placeholder(i) + " OR " + name + " IS NULL)"
+		}
+		return name + " > " + placeholder(i)
+	}
+	clauses := make([]string, 0, len(columns))
+	for i := range columns {
+		if values[i] == nil && columns[i].descending {
+			// No row sorts after a NULL in descending order.
+			continue
+		}
+		var conjuncts []string
+		for j := 0; j < i; j++ {
+			conjuncts = append(conjuncts, equal(j))
+		}
+		conjuncts = append(conjuncts, after(i))
+		if len(conjuncts) == 1 && strings.HasPrefix(conjuncts[0], "(") {
+			// The condition is already parenthesized.
+			clauses = append(clauses, conjuncts[0])
+			continue
+		}
+		clauses = append(clauses, "("+strings.Join(conjuncts, " AND ")+")")
+	}
+	if len(clauses) == 0 {
+		return "(FALSE)", w.parameters, nil
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", w.parameters, nil
+}
+
+// keysetColumn is a column of the order of a keyset.
+type keysetColumn struct {
+	column     *Column
+	descending bool
+}
+
+// keysetColumns returns the columns of the given order, which must be
+// sortable and distinct, followed by the tie-breaker column of the table.
+func (t *Table) keysetColumns(order []OrderBy) ([]keysetColumn, error) {
+	if t.tieBreaker == nil {
+		return nil, fmt.Errorf("keyset pagination requires a tie-breaker column, see TableBuilder.WithTieBreaker")
+	}
+	columns := make([]keysetColumn, 0, len(order)+1)
+	seenColumns := make(map[string]struct{})
+	for _, o := range order {
+		column, err := t.SortableColumnByFieldPath(o.FieldPath)
+		if err != nil {
+			return nil, err
+		}
+		if column.keyValue {
+			return nil, fmt.Errorf("cannot paginate by key value column %q", column.fieldPath.String())
+		}
+		if _, ok := seenColumns[column.databaseName]; ok {
+			return nil, fmt.Errorf("field appears in order_by multiple times: %q", o.FieldPath.String())
+		}
+		seenColumns[column.databaseName] = struct{}{}
+		columns = append(columns, keysetColumn{column: column, descending: o.Descending})
+	}
+	if _, ok := seenColumns[t.tieBreaker.databaseName]; !ok {
+		columns = append(columns, keysetColumn{column: t.tieBreaker})
+	}
+	return columns, nil
+}
+
+// cursorValue converts a cursor value to the Go type of the column, as
+// documented on QueryParameter.Value, or nil for NULLs.
+func cursorValue(column *Column, v any) (any, error) {
+	value, ok := normalizeValue(v)
+	if !ok {
+		return nil, nil
+	}
+	value, err := columnValue(column, value)
+	if err != nil {
+		return nil, fmt.Errorf("cursor value of field %q: %w", column.fieldPath.String(), err)
+	}
+	return value, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeysetClause(t *testing.T) {
+	Convey("KeysetClause", t, func() {
+		table := NewTable().WithColumns(
+			NewColumn().WithFieldPath("foo").WithDatabaseName("db_foo").Sortable().Build(),
+			NewColumn().WithFieldPath("bar").WithDatabaseName("db_bar").Int64().Sortable().Build(),
+			NewColumn().WithFieldPath("time").WithDatabaseName("db_time").Timestamp().Sortable().Build(),
+			NewColumn().WithFieldPath("bool").WithDatabaseName("db_bool").Bool().Sortable().Build(),
+			NewColumn().WithFieldPath("kv").WithDatabaseName("db_kv").KeyValue().Sortable().Build(),
+			NewColumn().WithFieldPath("unsortable").WithDatabaseName("unsortable").Build(),
+			NewColumn().WithFieldPath("id").WithDatabaseName("db_id").Int64().Sortable().Build(),
+		).WithTieBreaker("id").Build()
+		ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		Convey("Empty cursor", func() {
+			result, pars, err := table.KeysetClause([]OrderBy{{FieldPath: NewFieldPath("foo")}}, nil, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "(TRUE)")
+			So(pars, ShouldHaveLength, 0)
+		})
+		Convey("Single field", func() {
+			result, pars, err := table.KeysetClause([]OrderBy{{FieldPath: NewFieldPath("foo")}}, map[string]any{"foo": "x", "id": 7}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_foo > @k_0) OR (db_foo = @k_0 AND db_id > @k_1))")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "k_0", Value: "x"}, {Name: "k_1", Value: int64(7)}})
+		})
+		Convey("Multiple fields", func() {
+			order, err := ParseOrderBy("foo, bar desc, time")
+			So(err, ShouldBeNil)
+			cursor := map[string]any{"foo": "x", "bar": 3, "time": ts, "id": int64(7)}
+			result, pars, err := table.KeysetClause(order, cursor, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_foo > @k_0) OR (db_foo = @k_0 AND (db_bar < @k_1 OR db_bar IS NULL)) OR (db_foo = @k_0 AND db_bar = @k_1 AND db_time > @k_2)"+
+				" OR (db_foo = @k_0 AND db_bar = @k_1 AND db_time = @k_2 AND db_id > @k_3))")
+			So(pars, ShouldResemble, []QueryParameter{
+				{Name: "k_0", Value: "x"},
+				{Name: "k_1", Value: int64(3)},
+				{Name: "k_2", Value: ts},
+				{Name: "k_3", Value: int64(7)},
+			})
+		})
+		Convey("Tie-breaker in order", func() {
+			order, err := ParseOrderBy("id desc, foo")
+			So(err, ShouldBeNil)
+			result, pars, err := table.KeysetClause(order, map[string]any{"foo": "x", "id": 7}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_id < @k_0 OR db_id IS NULL) OR (db_id = @k_0 AND db_foo > @k_1))")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "k_0", Value: int64(7)}, {Name: "k_1", Value: "x"}})
+		})
+		Convey("Tie-breaker only", func() {
+			result, pars, err := table.KeysetClause(nil, map[string]any{"id": 7}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_id > @k_0))")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "k_0", Value: int64(7)}})
+		})
+		Convey("Positional dialect", func() {
+			order, err := ParseOrderBy("foo desc, bar")
+			So(err, ShouldBeNil)
+			result, pars, err := table.WithDialect(MySQL).KeysetClause(order, map[string]any{"foo": "x", "bar": int64(3), "id": 7}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((`db_foo` < ? OR `db_foo` IS NULL) OR (`db_foo` = ? AND `db_bar` > ?) OR (`db_foo` = ? AND `db_bar` = ? AND `db_id` > ?))")
+			So(PositionalArgs(pars), ShouldResemble, []any{"x", "x", int64(3), "x", int64(3), int64(7)})
+		})
+		Convey("Boolean fields", func() {
+			order, err := ParseOrderBy("bool, foo")
+			So(err, ShouldBeNil)
+			result, pars, err := table.KeysetClause(order, map[string]any{"bool": true, "foo": "x", "id": 7}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_bool > TRUE) OR (db_bool = TRUE AND db_foo > @k_0) OR (db_bool = TRUE AND db_foo = @k_0 AND db_id > @k_1))")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "k_0", Value: "x"}, {Name: "k_1", Value: int64(7)}})
+		})
+		Convey("NULL cursor values", func() {
+			order, err := ParseOrderBy("foo, bar desc")
+			So(err, ShouldBeNil)
+			result, pars, err := table.KeysetClause(order, map[string]any{"foo": nil, "bar": 3, "id": 7}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_foo IS NOT NULL) OR (db_foo IS NULL AND (db_bar < @k_0 OR db_bar IS NULL)) OR (db_foo IS NULL AND db_bar = @k_0 AND db_id > @k_1))")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "k_0", Value: int64(3)}, {Name: "k_1", Value: int64(7)}})
+
+			// No row sorts after a NULL in descending order.
+			result, pars, err = table.KeysetClause(order, map[string]any{"foo": "x", "bar": nil, "id": 7}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_foo > @k_0) OR (db_foo = @k_0 AND db_bar IS NULL AND db_id > @k_1))")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "k_0", Value: "x"}, {Name: "k_1", Value: int64(7)}})
+
+			result, _, err = table.KeysetClause([]OrderBy{{FieldPath: NewFieldPath("foo"), Descending: true}}, map[string]any{"foo": nil, "id": nil}, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "((db_foo IS NULL AND db_id IS NOT NULL))")
+		})
+		Convey("Invalid cursors", func() {
+			order, err := ParseOrderBy("foo, bar")
+			So(err, ShouldBeNil)
+			_, _, err = table.KeysetClause(order, map[string]any{"foo": "x", "id": 7}, "k_")
+			So(err, ShouldErrLike, "cursor has no value for field \"bar\"")
+			_, _, err = table.KeysetClause(order, map[string]any{"foo": "x", "bar": 1}, "k_")
+			So(err, ShouldErrLike, "cursor has no value for field \"id\"")
+			_, _, err = table.KeysetClause(order, map[string]any{"foo": "x", "bar": "y"}, "k_")
+			So(err, ShouldErrLike, "cursor value of field \"bar\": expected a value of type INT64 but got string")
+		})
+		Convey("Invalid orders", func() {
+			_, _, err := table.KeysetClause([]OrderBy{{FieldPath: NewFieldPath("unsortable")}}, map[string]any{"unsortable": "x"}, "k_")
+			So(err, ShouldErrLike, "no sortable field named \"unsortable\"")
+			_, _, err = table.KeysetClause([]OrderBy{{FieldPath: NewFieldPath("kv")}}, map[string]any{"kv": "x"}, "k_")
+			So(err, ShouldErrLike, "cannot paginate by key value column \"kv\"")
+
+			noTieBreaker := NewTable().WithColumns(
+				NewColumn().WithFieldPath("foo").WithDatabaseName("db_foo").Sortable().Build(),
+			).Build()
+			_, _, err = noTieBreaker.KeysetClause([]OrderBy{{FieldPath: NewFieldPath("foo")}}, map[string]any{"foo": "x"}, "k_")
+			So(err, ShouldErrLike, "keyset pagination requires a tie-breaker column")
+		})
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"bytes"
+	"cmp"
+	"strings"
+	"time"
+)
+
+// Less returns a function reporting whether a sorts before b according
+// to the given order, for use with sort.Slice or slices.SortFunc (through
+// Compare). This allows the same order_by to be applied to cached or
+// merged result sets as to SQL queries.
+//
+// Field paths are resolved against struct fields, map keys and proto
+// message fields as described in field_value.go. Missing values (e.g. nil
+// pointers or unset message fields) sort before present values in
+// ascending order and after them in descending order, as NULLs do with
+// Table.OrderByClause. Values of incomparable types are considered equal.
+//
+// Less does not validate the field paths; use Table.OrderByClause or
+// Table.SortableColumnByFieldPath to validate a user-supplied order first.
+func Less[T any](order []OrderBy) func(a, b T) bool {
+	compare := Compare[T](order)
+	return func(a, b T) bool {
+		return compare(a, b) < 0
+	}
+}
+
+// Compare returns a function comparing a and b according to the given
+// order, returning -1, 0 or +1. See Less for details.
+func Compare[T any](order []OrderBy) func(a, b T) int {
+	return func(a, b T) int {
+		for _, o := range order {
+			x, xok := fieldValue(a, o.FieldPath.segments)
+			y, yok := fieldValue(b, o.FieldPath.segments)
+			var c int
+			switch {
+			case !xok && !yok:
+				c = 0
+			case !xok:
+				c = -1
+			case !yok:
+				c = 1
+			default:
+				c, _ = compareValues(x, y)
+			}
+			if c != 0 {
+				if o.Descending {
+					return -c
+				}
+				return c
+			}
+		}
+		return 0
+	}
+}
+
+// compareValues compares two values normalized by fieldValue, returning
+// -1, 0 or +1, and whether the values are comparable.
+func compareValues(a, b any) (int, bool) {
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			}
+			return 1, true
+		}
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, y), true
+		case float64:
+			return cmp.Compare(float64(x), y), true
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, float64(y)), true
+		case float64:
+			return cmp.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	case time.Duration:
+		if y, ok := b.(time.Duration); ok {
+			return cmp.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
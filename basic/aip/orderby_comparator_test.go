@@ -0,0 +1,128 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type lessTestItem struct {
+	Name       string
+	Priority   *int
+	CreateTime time.Time
+	Labels     map[string]string
+}
+
+func TestLess(t *testing.T) {
+	Convey("Less", t, func() {
+		one, two := 1, 2
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		items := []*lessTestItem{
+			{Name: "b", Priority: &two, CreateTime: base.Add(2 * time.Hour), Labels: map[string]string{"env": "prod"}},
+			{Name: "a", Priority: &one, CreateTime: base.Add(time.Hour)},
+			{Name: "c", Priority: &one, CreateTime: base.Add(3 * time.Hour), Labels: map[string]string{"env": "dev"}},
+			{Name: "d", CreateTime: base},
+		}
+		names := func(items []*lessTestItem) []string {
+			var result []string
+			for _, item := range items {
+				result = append(result, item.Name)
+			}
+			return result
+		}
+		sortBy := func(orderBy string) []string {
+			order, err := ParseOrderBy(orderBy)
+			So(err, ShouldBeNil)
+			less := Less[*lessTestItem](order)
+			sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+			return names(items)
+		}
+
+		Convey("Single field", func() {
+			So(sortBy("name"), ShouldResemble, []string{"a", "b", "c", "d"})
+			So(sortBy("name desc"), ShouldResemble, []string{"d", "c", "b", "a"})
+			So(sortBy("create_time"), ShouldResemble, []string{"d", "a", "b", "c"})
+		})
+		Convey("Multiple fields", func() {
+			So(sortBy("priority desc, name desc"), ShouldResemble, []string{"b", "c", "a", "d"})
+			So(sortBy("priority, create_time desc"), ShouldResemble, []string{"d", "c", "a", "b"})
+		})
+		Convey("Missing values sort first", func() {
+			So(sortBy("priority, name"), ShouldResemble, []string{"d", "a", "c", "b"})
+			So(sortBy("labels.env, name"), ShouldResemble, []string{"a", "d", "c", "b"})
+		})
+		Convey("Merged with default order", func() {
+			order, err := ParseOrderBy("priority")
+			So(err, ShouldBeNil)
+			order = MergeWithDefaultOrder([]OrderBy{{FieldPath: NewFieldPath("name"), Descending: true}}, order)
+			less := Less[*lessTestItem](order)
+			sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+			So(names(items), ShouldResemble, []string{"d", "c", "a", "b"})
+		})
+		Convey("Maps", func() {
+			rows := []map[string]any{
+				{"name": "x", "size": 2.5},
+				{"name": "y", "size": 1},
+				{"name": "z", "size": uint8(2)},
+			}
+			order, err := ParseOrderBy("size")
+			So(err, ShouldBeNil)
+			less := Less[map[string]any](order)
+			sort.Slice(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+			So([]any{rows[0]["name"], rows[1]["name"], rows[2]["name"]}, ShouldResemble, []any{"y", "z", "x"})
+		})
+		Convey("Proto messages", func() {
+			md := testBookDescriptor()
+			book := func(name string, pages int32, author string) proto.Message {
+				m := dynamicpb.NewMessage(md)
+				m.Set(md.Fields().ByName("name"), protoreflect.ValueOfString(name))
+				m.Set(md.Fields().ByName("pages"), protoreflect.ValueOfInt32(pages))
+				if author != "" {
+					a := dynamicpb.NewMessage(md.Messages().ByName("Author"))
+					a.Set(a.Descriptor().Fields().ByName("display_name"), protoreflect.ValueOfString(author))
+					m.Set(md.Fields().ByName("author"), protoreflect.ValueOfMessage(a))
+				}
+				return m
+			}
+			books := []proto.Message{book("b1", 100, "Pike"), book("b2", 300, ""), book("b3", 200, "Kernighan")}
+			bookNames := func() []string {
+				var result []string
+				for _, b := range books {
+					result = append(result, b.ProtoReflect().Get(md.Fields().ByName("name")).String())
+				}
+				return result
+			}
+
+			order, err := ParseOrderBy("pages desc")
+			So(err, ShouldBeNil)
+			less := Less[proto.Message](order)
+			sort.Slice(books, func(i, j int) bool { return less(books[i], books[j]) })
+			So(bookNames(), ShouldResemble, []string{"b2", "b3", "b1"})
+
+			order, err = ParseOrderBy("author.display_name")
+			So(err, ShouldBeNil)
+			less = Less[proto.Message](order)
+			sort.Slice(books, func(i, j int) bool { return less(books[i], books[j]) })
+			So(bookNames(), ShouldResemble, []string{"b2", "b3", "b1"})
+		})
+	})
+}
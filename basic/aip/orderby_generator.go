@@ -43,10 +43,16 @@ func MergeWithDefaultOrder(defaultOrder []OrderBy, order []OrderBy) []OrderBy {
 // "ORDER BY" and trailing new line (if an order is specified).
 // If no order is specified, returns "".
 //
+// If the table has a tie-breaker column which does not appear in the
+// order, it is appended in ascending order.
+//
+// NULLs sort first in ascending order and last in descending order in
+// every dialect, as in Less and KeysetClause.
+//
 // The returned order clause is safe against SQL injection; only
 // strings appearing from Table appear in the output.
 func (t *Table) OrderByClause(order []OrderBy) (string, error) {
-	if len(order) == 0 {
+	if len(order) == 0 && t.tieBreaker == nil {
 		return "", nil
 	}
 	seenColumns := make(map[string]struct{})
@@ -63,9 +69,14 @@ func (t *Table) OrderByClause(order []OrderBy) (string, error) {
 			return "", fmt.Errorf("field appears in order_by multiple times: %q", o.FieldPath.String())
 		}
 		seenColumns[column.databaseName] = struct{}{}
-		result.WriteString(column.databaseName)
-		if o.Descending {
-			result.WriteString(" DESC")
+		result.WriteString(t.Dialect().Order(t.Dialect().QuoteIdentifier(column.databaseName), o.Descending))
+	}
+	if t.tieBreaker != nil {
+		if _, ok := seenColumns[t.tieBreaker.databaseName]; !ok {
+			if result.Len() > 0 {
+				result.WriteString(", ")
+			}
+			result.WriteString(t.Dialect().Order(t.Dialect().QuoteIdentifier(t.tieBreaker.databaseName), false))
 		}
 	}
 	return result.String(), nil
@@ -61,6 +61,35 @@ func TestOrderByClause(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(result, ShouldEqual, "db_foo DESC, db_bar, db_baz DESC")
 		})
+		Convey("Tie-breaker", func() {
+			table := NewTable().WithColumns(
+				NewColumn().WithFieldPath("foo").WithDatabaseName("db_foo").Sortable().Build(),
+				NewColumn().WithFieldPath("id").WithDatabaseName("db_id").Build(),
+			).WithTieBreaker("id").Build()
+
+			result, err := table.OrderByClause([]OrderBy{{FieldPath: NewFieldPath("foo"), Descending: true}})
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "db_foo DESC, db_id")
+
+			result, err = table.OrderByClause(nil)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "db_id")
+
+			_, err = NewTable().WithColumns(
+				NewColumn().WithFieldPath("foo").WithDatabaseName("db_foo").Sortable().Build(),
+			).WithTieBreaker("id").TryBuild()
+			So(err, ShouldErrLike, "no column for the tie-breaker field path: id")
+
+			_, err = NewTable().WithColumns(
+				NewColumn().WithFieldPath("id").WithDatabaseName("db_id").Repeated().Build(),
+			).WithTieBreaker("id").TryBuild()
+			So(err, ShouldErrLike, "tie-breaker cannot be a repeated column: id")
+
+			_, err = NewTable().WithColumns(
+				NewColumn().WithFieldPath("id").WithDatabaseName("db_id").JSON().Build(),
+			).WithTieBreaker("id").TryBuild()
+			So(err, ShouldErrLike, "tie-breaker cannot be a JSON column: id")
+		})
 		Convey("Unsortable field in order by", func() {
 			_, err := table.OrderByClause([]OrderBy{
 				{
@@ -126,6 +126,26 @@ func (f FieldPath) String() string {
 // syntax is correct and each identifier appears at most once, but
 // it does not validate the identifiers themselves are valid.
 func ParseOrderBy(text string) ([]OrderBy, error) {
+	return ParseOrderByWithOptions(text, OrderByOptions{})
+}
+
+// OrderByOptions are limits on the order_by lists accepted by
+// ParseOrderByWithOptions. A zero value means no limit.
+type OrderByOptions struct {
+	// MaxClauses is the maximum number of fields to order by.
+	MaxClauses int
+	// MaxLength is the maximum length of the order_by list in bytes.
+	MaxLength int
+}
+
+// ParseOrderByWithOptions parses an AIP-132 order_by list as ParseOrderBy,
+// and returns a *LimitExceededError if the list exceeds one of the limits
+// of the options.
+func ParseOrderByWithOptions(text string, options OrderByOptions) ([]OrderBy, error) {
+	if options.MaxLength > 0 && len(text) > options.MaxLength {
+		return nil, &LimitExceededError{Field: "order_by", Limit: "MaxLength", Max: options.MaxLength}
+	}
+
 	// Empty order_by list.
 	if strings.Trim(text, " ") == "" {
 		return nil, nil
@@ -135,8 +155,11 @@ func ParseOrderBy(text string) ([]OrderBy, error) {
 	if err != nil {
 		return nil, errors.WithMessagef(errors.WithStack(err), "syntax error")
 	}
+	if options.MaxClauses > 0 && len(expr.SortOrder) > options.MaxClauses {
+		return nil, &LimitExceededError{Field: "order_by", Limit: "MaxClauses", Max: options.MaxClauses}
+	}
 
-	result := make([]OrderBy, len(expr.SortOrder))
+	result := make([]OrderBy, 0, len(expr.SortOrder))
 	for _, clause := range expr.SortOrder {
 		result = append(result, OrderBy{
 			FieldPath:  NewFieldPath(clause.FieldPath.Path()...),
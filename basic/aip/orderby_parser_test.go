@@ -107,7 +107,20 @@ func TestParseOrderBy(t *testing.T) {
 		})
 		Convey("Invalid input is rejected", func() {
 			_, err := ParseOrderBy("`something")
-			So(err, ShouldErrLike, "syntax error: 1:1: invalid input text \"`something\"")
+			So(err, ShouldErrLike, "syntax error: 1:1:", "invalid input text \"`something\"")
+		})
+		Convey("Limits", func() {
+			options := OrderByOptions{MaxClauses: 2, MaxLength: 20}
+			result, err := ParseOrderByWithOptions("foo, bar desc", options)
+			So(err, ShouldBeNil)
+			So(result, ShouldHaveLength, 2)
+
+			_, err = ParseOrderByWithOptions("foo, bar, baz", options)
+			So(err, ShouldResemble, &LimitExceededError{Field: "order_by", Limit: "MaxClauses", Max: 2})
+			So(err, ShouldErrLike, "order_by exceeds the maximum number of fields of 2")
+
+			_, err = ParseOrderByWithOptions("a_very_long_field_name desc", options)
+			So(err, ShouldResemble, &LimitExceededError{Field: "order_by", Limit: "MaxLength", Max: 20})
 		})
 		Convey("Empty order by", func() {
 			Convey("Spaces only", func() {
@@ -0,0 +1,195 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidPageToken is returned (wrapped) by Paginator.Cursor for page
+// tokens which are malformed, were tampered with, or were issued for a
+// request with a different filter or order_by. AIP-158 servers should
+// report it as INVALID_ARGUMENT.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Paginator issues and verifies AIP-158 page tokens for keyset
+// pagination of a table.
+//
+// A page token holds the values of the order_by fields and of the
+// tie-breaker column in the last row of a page, and a digest of the filter and order_by of the request. It
+// is signed with HMAC-SHA256, so clients cannot forge cursors, nor reuse
+// a token with a different filter or order_by.
+//
+// Typical usage in a List RPC:
+//
+//	cursor, err := paginator.Cursor(req.PageToken, req.Filter, order)
+//	...
+//	where, wherePars, err := table.WhereClause(filter, "p_")
+//	...
+//	keyset, keysetPars, err := table.WithParameterOffset(len(wherePars)).KeysetClause(order, cursor, "k_")
+//	...
+//	// Query page_size+1 rows to know whether there is a next page.
+//	if len(rows) > pageSize {
+//		rows = rows[:pageSize]
+//		nextPageToken, err = paginator.NextPageToken(req.Filter, order, rows[pageSize-1])
+//	}
+type Paginator struct {
+	table *Table
+	key   []byte
+}
+
+// NewPaginator returns a paginator for the given table, signing page
+// tokens with the given secret key.
+func NewPaginator(table *Table, key []byte) *Paginator {
+	return &Paginator{table: table, key: key}
+}
+
+// pageToken is the payload of a page token.
+type pageToken struct {
+	// The SHA-256 digest of the filter.
+	Filter []byte `json:"f"`
+	// The canonical order_by.
+	OrderBy string `json:"o"`
+	// The values of the order_by fields, formatted as literals, or nil for
+	// NULLs.
+	Values []*string `json:"v"`
+}
+
+// NextPageToken returns the page token of the page following the given
+// row, which is the last row of a page of the request with the given
+// filter and order. The values of the order fields are resolved from the
+// row as described in field_value.go; missing values are NULLs.
+func (p *Paginator) NextPageToken(filter string, order []OrderBy, last any) (string, error) {
+	columns, err := p.table.keysetColumns(order)
+	if err != nil {
+		return "", err
+	}
+	token := pageToken{
+		Filter:  filterDigest(filter),
+		OrderBy: orderByText(order),
+		Values:  make([]*string, 0, len(columns)),
+	}
+	for _, k := range columns {
+		column := k.column
+		v, _ := fieldValue(last, column.fieldPath.segments)
+		value, err := cursorValue(column, v)
+		if err != nil {
+			return "", err
+		}
+		if value == nil {
+			token.Values = append(token.Values, nil)
+			continue
+		}
+		text, err := formatLiteral(column.columnType, value)
+		if err != nil {
+			return "", err
+		}
+		token.Values = append(token.Values, &text)
+	}
+	payload, err := json.Marshal(&token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, p.sign(payload)...)), nil
+}
+
+// Cursor verifies the page token was issued by NextPageToken for a
+// request with the same filter and order, and returns the cursor to pass
+// to Table.KeysetClause. An empty page token, requesting the first page,
+// yields a nil cursor.
+func (p *Paginator) Cursor(token, filter string, order []OrderBy) (map[string]any, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) < sha256.Size {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPageToken)
+	}
+	payload, signature := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(signature, p.sign(payload)) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidPageToken)
+	}
+	var content pageToken
+	if err := json.Unmarshal(payload, &content); err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPageToken)
+	}
+	if !bytes.Equal(content.Filter, filterDigest(filter)) {
+		return nil, fmt.Errorf("%w: the filter must not change between pages", ErrInvalidPageToken)
+	}
+	if content.OrderBy != orderByText(order) {
+		return nil, fmt.Errorf("%w: the order_by must not change between pages", ErrInvalidPageToken)
+	}
+	columns, err := p.table.keysetColumns(order)
+	if err != nil {
+		return nil, err
+	}
+	if len(content.Values) != len(columns) {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPageToken)
+	}
+	cursor := make(map[string]any, len(columns))
+	for i, k := range columns {
+		column := k.column
+		if content.Values[i] == nil {
+			cursor[column.fieldPath.String()] = nil
+			continue
+		}
+		value, err := parseLiteral(column.columnType, *content.Values[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s: %s", ErrInvalidPageToken, column.fieldPath.String(), err)
+		}
+		cursor[column.fieldPath.String()] = value
+	}
+	return cursor, nil
+}
+
+// sign returns the HMAC-SHA256 of the payload.
+func (p *Paginator) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// filterDigest returns the SHA-256 digest of a filter. Valid filters are
+// normalized with Format first, so that e.g. "a=1" and "a = 1" are
+// considered the same filter.
+func filterDigest(filter string) []byte {
+	if f, err := ParseFilter(filter); err == nil {
+		filter = Format(f)
+	}
+	digest := sha256.Sum256([]byte(filter))
+	return digest[:]
+}
+
+// orderByText returns the canonical AIP-132 representation of an order.
+func orderByText(order []OrderBy) string {
+	var result strings.Builder
+	for i, o := range order {
+		if i > 0 {
+			result.WriteString(", ")
+		}
+		result.WriteString(o.FieldPath.String())
+		if o.Descending {
+			result.WriteString(" desc")
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type pageTokenTestRow struct {
+	ID         int64
+	Name       string
+	Size       int
+	Rating     float64
+	Published  bool
+	CreateTime time.Time
+	TTL        time.Duration `aip:"path=ttl"`
+}
+
+func TestPaginator(t *testing.T) {
+	Convey("Paginator", t, func() {
+		table := NewTable().WithColumns(
+			NewColumn().WithFieldPath("name").WithDatabaseName("name").Sortable().Build(),
+			NewColumn().WithFieldPath("size").WithDatabaseName("size").Int64().Sortable().Build(),
+			NewColumn().WithFieldPath("rating").WithDatabaseName("rating").Float64().Sortable().Build(),
+			NewColumn().WithFieldPath("published").WithDatabaseName("published").Bool().Sortable().Build(),
+			NewColumn().WithFieldPath("create_time").WithDatabaseName("create_time").Timestamp().Sortable().Build(),
+			NewColumn().WithFieldPath("ttl").WithDatabaseName("ttl").Duration().Sortable().Build(),
+			NewColumn().WithFieldPath("id").WithDatabaseName("id").Int64().Build(),
+		).WithTieBreaker("id").Build()
+		paginator := NewPaginator(table, []byte("secret"))
+		order, err := ParseOrderBy("size desc, rating, published, create_time, ttl, name")
+		So(err, ShouldBeNil)
+		row := &pageTokenTestRow{
+			ID:         7,
+			Name:       "x",
+			Size:       42,
+			Rating:     0.1,
+			Published:  true,
+			CreateTime: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+			TTL:        -1500*time.Millisecond - 1,
+		}
+		const filter = "name:x"
+		token, err := paginator.NextPageToken(filter, order, row)
+		So(err, ShouldBeNil)
+
+		Convey("Round trip", func() {
+			cursor, err := paginator.Cursor(token, filter, order)
+			So(err, ShouldBeNil)
+			So(cursor, ShouldResemble, map[string]any{
+				"name":        "x",
+				"size":        int64(42),
+				"rating":      0.1,
+				"published":   true,
+				"create_time": row.CreateTime,
+				"ttl":         row.TTL,
+				"id":          int64(7),
+			})
+			result, _, err := table.KeysetClause(order, cursor, "k_")
+			So(err, ShouldBeNil)
+			So(result, ShouldStartWith, "((size < @k_0 OR size IS NULL) OR ")
+		})
+		Convey("First page", func() {
+			cursor, err := paginator.Cursor("", filter, order)
+			So(err, ShouldBeNil)
+			So(cursor, ShouldBeNil)
+		})
+		Convey("Equivalent filter", func() {
+			_, err := paginator.Cursor(token, "(name : x)", order)
+			So(err, ShouldBeNil)
+		})
+		Convey("Changed request", func() {
+			_, err := paginator.Cursor(token, "name:y", order)
+			So(err, ShouldErrLike, "invalid page token: the filter must not change between pages")
+			So(errors.Is(err, ErrInvalidPageToken), ShouldBeTrue)
+			_, err = paginator.Cursor(token, filter, order[1:])
+			So(err, ShouldErrLike, "invalid page token: the order_by must not change between pages")
+		})
+		Convey("Tampered tokens", func() {
+			data, err := base64.RawURLEncoding.DecodeString(token)
+			So(err, ShouldBeNil)
+			data[len(data)/2] ^= 1
+			_, err = paginator.Cursor(base64.RawURLEncoding.EncodeToString(data), filter, order)
+			So(err, ShouldErrLike, "invalid page token: bad signature")
+
+			_, err = NewPaginator(table, []byte("other")).Cursor(token, filter, order)
+			So(err, ShouldErrLike, "invalid page token: bad signature")
+
+			_, err = paginator.Cursor("!!", filter, order)
+			So(err, ShouldErrLike, "invalid page token: malformed token")
+		})
+		Convey("NULL values", func() {
+			token, err := paginator.NextPageToken(filter, order, map[string]any{"name": "x", "id": 7})
+			So(err, ShouldBeNil)
+			cursor, err := paginator.Cursor(token, filter, order)
+			So(err, ShouldBeNil)
+			So(cursor, ShouldResemble, map[string]any{
+				"name":        "x",
+				"size":        nil,
+				"rating":      nil,
+				"published":   nil,
+				"create_time": nil,
+				"ttl":         nil,
+				"id":          int64(7),
+			})
+		})
+		Convey("Invalid rows", func() {
+			_, err := paginator.NextPageToken(filter, order, map[string]any{"name": "x", "size": "big"})
+			So(err, ShouldErrLike, "cursor value of field \"size\": expected a value of type INT64 but got string")
+			_, err = paginator.NextPageToken(filter, []OrderBy{{FieldPath: NewFieldPath("other")}}, row)
+			So(err, ShouldErrLike, "no sortable field named \"other\"")
+		})
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UpdateClause creates a Standard SQL SET clause updating the columns
+// selected by an AIP-134 update_mask to their values in the given
+// resource, e.g. "SET title = @u_0, author_name = @u_1".
+// Also returns the query parameters which need to be given to the database.
+//
+// Columns are selected as in SelectClause. A "*" mask selects every
+// updatable column (full replacement), and an empty mask selects the
+// updatable columns with a non-zero value in the resource, as specified
+// by AIP-134. Output only columns are silently ignored, other columns
+// must be marked Updatable. Key value, repeated and JSON columns cannot
+// be updated.
+//
+// Values are resolved from the resource (a struct, map or proto message)
+// by field path as described in field_value.go; missing values set the
+// column to NULL. Placeholders and quoting follow the Dialect of the
+// table, as in WhereClause. When the statement has a WHERE clause after
+// the SET clause, generate it with WithParameterOffset for dialects
+// numbering their placeholders.
+//
+// The returned clause is SQL injection safe: column names come from the
+// table and all values are passed via query parameters.
+func (t *Table) UpdateClause(mask FieldMask, resource any, parameterPrefix string) (string, []QueryParameter, error) {
+	columns, err := t.updateColumns(mask, resource)
+	if err != nil {
+		return "", []QueryParameter{}, err
+	}
+	if len(columns) == 0 {
+		return "", []QueryParameter{}, fmt.Errorf("no updatable field in the update mask")
+	}
+
+	w := &whereClause{
+		table:           t,
+		dialect:         t.Dialect(),
+		namePrefix:      parameterPrefix,
+		parameterOffset: t.parameterOffset,
+	}
+	assignments := make([]string, 0, len(columns))
+	for _, column := range columns {
+		value := "NULL"
+		if v, ok := fieldValue(resource, column.fieldPath.segments); ok {
+			v, err := columnValue(column, v)
+			if err != nil {
+				return "", []QueryParameter{}, fmt.Errorf("field %s: %w", column.fieldPath.String(), err)
+			}
+			value = w.literal(v)
+		}
+		assignments = append(assignments, w.columnName(column)+" = "+value)
+	}
+	return "SET " + strings.Join(assignments, ", "), w.parameters, nil
+}
+
+// updateColumns returns the columns to update with the given mask and
+// resource, in the order of the table columns.
+func (t *Table) updateColumns(mask FieldMask, resource any) ([]*Column, error) {
+	var result []*Column
+	switch {
+	case mask.All():
+		for _, column := range t.columns {
+			if column.updatable && !column.keyValue && !column.repeated && !column.json {
+				result = append(result, column)
+			}
+		}
+	case mask.IsEmpty():
+		for _, column := range t.columns {
+			if !column.updatable || column.keyValue || column.repeated || column.json {
+				continue
+			}
+			if v, ok := fieldValue(resource, column.fieldPath.segments); ok && !reflect.ValueOf(v).IsZero() {
+				result = append(result, column)
+			}
+		}
+	default:
+		columns, err := t.columnsByFieldMask(mask)
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range columns {
+			if column.outputOnly {
+				continue
+			}
+			if !column.updatable {
+				return nil, fmt.Errorf("field %q is not updatable", column.fieldPath.String())
+			}
+			if column.keyValue {
+				return nil, fmt.Errorf("key value column %q cannot be updated", column.fieldPath.String())
+			}
+			if column.repeated {
+				return nil, fmt.Errorf("repeated column %q cannot be updated", column.fieldPath.String())
+			}
+			if column.json {
+				return nil, fmt.Errorf("JSON column %q cannot be updated", column.fieldPath.String())
+			}
+			result = append(result, column)
+		}
+	}
+	return result, nil
+}
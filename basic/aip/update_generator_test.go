@@ -0,0 +1,128 @@
+// Copyright 2022 The imkuqin-zw Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aip
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/imkuqin-zw/pkg/basic/aip/testing/assertions"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type updateTestAuthor struct {
+	DisplayName string
+	Email       *string
+}
+
+type updateTestBook struct {
+	Name       string
+	Title      string
+	Pages      int
+	Published  bool
+	Author     updateTestAuthor
+	Labels     map[string]string
+	Tags       []string
+	UpdateTime time.Time
+}
+
+func TestUpdateClause(t *testing.T) {
+	Convey("UpdateClause", t, func() {
+		table := NewTable().WithColumns(
+			NewColumn().WithFieldPath("name").WithDatabaseName("db_name").Build(),
+			NewColumn().WithFieldPath("title").WithDatabaseName("db_title").Updatable().Build(),
+			NewColumn().WithFieldPath("pages").WithDatabaseName("db_pages").Int64().Updatable().Build(),
+			NewColumn().WithFieldPath("published").WithDatabaseName("db_published").Bool().Updatable().Build(),
+			NewColumn().WithFieldPath("author", "display_name").WithDatabaseName("author_name").Updatable().Build(),
+			NewColumn().WithFieldPath("author", "email").WithDatabaseName("author_email").Updatable().Build(),
+			NewColumn().WithFieldPath("labels").WithDatabaseName("db_labels").KeyValue().Updatable().Build(),
+			NewColumn().WithFieldPath("tags").WithDatabaseName("db_tags").Repeated().Updatable().Build(),
+			NewColumn().WithFieldPath("spec").WithDatabaseName("db_spec").JSON().Updatable().Build(),
+			NewColumn().WithFieldPath("update_time").WithDatabaseName("db_update_time").Timestamp().OutputOnly().Build(),
+		).Build()
+		book := &updateTestBook{
+			Name:       "books/1",
+			Title:      "Go",
+			Pages:      380,
+			Published:  true,
+			Author:     updateTestAuthor{DisplayName: "Donovan"},
+			Tags:       []string{"go"},
+			UpdateTime: time.Now(),
+		}
+		updateClause := func(mask string, resource any) (string, []QueryParameter, error) {
+			m, err := ParseFieldMask(mask)
+			So(err, ShouldBeNil)
+			return table.UpdateClause(m, resource, "u_")
+		}
+
+		Convey("Field mask", func() {
+			result, pars, err := updateClause("pages, title", book)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "SET db_title = @u_0, db_pages = @u_1")
+			So(pars, ShouldResemble, []QueryParameter{
+				{Name: "u_0", Value: "Go"},
+				{Name: "u_1", Value: int64(380)},
+			})
+		})
+		Convey("Booleans and missing values", func() {
+			result, pars, err := updateClause("published, author", book)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "SET db_published = TRUE, author_name = @u_0, author_email = NULL")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "u_0", Value: "Donovan"}})
+		})
+		Convey("Full replacement", func() {
+			result, pars, err := updateClause("*", book)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "SET db_title = @u_0, db_pages = @u_1, db_published = TRUE, author_name = @u_2, author_email = NULL")
+			So(pars, ShouldHaveLength, 3)
+		})
+		Convey("Empty mask updates populated fields", func() {
+			result, pars, err := updateClause("", map[string]any{"title": "Go", "pages": 0, "update_time": time.Now()})
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "SET db_title = @u_0")
+			So(pars, ShouldResemble, []QueryParameter{{Name: "u_0", Value: "Go"}})
+		})
+		Convey("Output only fields are ignored", func() {
+			result, _, err := updateClause("title, update_time", book)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "SET db_title = @u_0")
+
+			_, _, err = updateClause("update_time", book)
+			So(err, ShouldErrLike, "no updatable field in the update mask")
+		})
+		Convey("Positional dialect", func() {
+			m, err := ParseFieldMask("title,pages")
+			So(err, ShouldBeNil)
+			result, pars, err := table.WithDialect(MySQL).UpdateClause(m, book, "u_")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "SET `db_title` = ?, `db_pages` = ?")
+			So(PositionalArgs(pars), ShouldResemble, []any{"Go", int64(380)})
+		})
+		Convey("Invalid masks", func() {
+			_, _, err := updateClause("name", book)
+			So(err, ShouldErrLike, "field \"name\" is not updatable")
+			_, _, err = updateClause("labels.env", book)
+			So(err, ShouldErrLike, "key value column \"labels\" cannot be updated")
+			_, _, err = updateClause("tags", book)
+			So(err, ShouldErrLike, "repeated column \"tags\" cannot be updated")
+			_, _, err = updateClause("spec.replicas", book)
+			So(err, ShouldErrLike, "JSON column \"spec\" cannot be updated")
+			_, _, err = updateClause("isbn", book)
+			So(err, ShouldErrLike, "no field named \"isbn\"")
+			_, _, err = updateClause("pages", map[string]any{"pages": "many"})
+			So(err, ShouldErrLike, "field pages: expected a value of type INT64 but got string")
+		})
+	})
+}